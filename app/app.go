@@ -0,0 +1,280 @@
+// Package app runs the servers of a binary, e.g. the HttpServer, the probes
+// and the background workers, under one context: they start in order, the
+// first failure or a signal stops them all in the reverse order.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"pkgx/eprobe"
+	"pkgx/httpx"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+var errServerStartup = errors.New("app: server stopped before startup")
+
+type options struct {
+	id      string
+	name    string
+	version string
+
+	ctx          context.Context
+	signals      []os.Signal
+	startTimeout time.Duration
+	stopTimeout  time.Duration
+	servers      []httpx.Server
+	logger       httpx.Logger
+}
+
+type Option func(o *options)
+
+func ID(id string) Option {
+	return func(o *options) {
+		o.id = id
+	}
+}
+
+func Name(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+func Version(version string) Option {
+	return func(o *options) {
+		o.version = version
+	}
+}
+
+// Context sets the parent context of the application.
+func Context(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// Signals sets the signals that stop the application, SIGINT and SIGTERM by
+// default. Signals() disables the handling of signals.
+func Signals(signals ...os.Signal) Option {
+	return func(o *options) {
+		o.signals = signals
+	}
+}
+
+// StartTimeout sets how long a server may take to pass its startup probe
+// before the next one starts, 30s by default.
+func StartTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.startTimeout = timeout
+	}
+}
+
+// StopTimeout sets how long each server may take to stop, 30s by default.
+func StopTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.stopTimeout = timeout
+	}
+}
+
+// Servers adds servers, they start in the order of their registration.
+func Servers(servers ...httpx.Server) Option {
+	return func(o *options) {
+		o.servers = append(o.servers, servers...)
+	}
+}
+
+func WithLogger(logger httpx.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// App runs a set of servers.
+type App struct {
+	opts options
+
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	instances []httpx.Instance
+}
+
+var _ httpx.Instance = (*App)(nil)
+
+func New(opts ...Option) *App {
+	o := options{
+		id:           uuid.New().String(),
+		version:      "v0.0.0",
+		ctx:          context.Background(),
+		signals:      []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+		startTimeout: 30 * time.Second,
+		stopTimeout:  30 * time.Second,
+		logger:       httpx.DefaultLogger,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &App{opts: o}
+}
+
+func (a *App) ID() string {
+	return a.opts.id
+}
+
+func (a *App) Name() string {
+	return a.opts.name
+}
+
+func (a *App) Version() string {
+	return a.opts.version
+}
+
+// Endpoint returns the endpoints of the started instances.
+func (a *App) Endpoint() []string {
+	var endpoints []string
+	for _, ins := range a.Instances() {
+		endpoints = append(endpoints, ins.Endpoint()...)
+	}
+	return endpoints
+}
+
+// Instances returns the started servers that implement httpx.Instance.
+func (a *App) Instances() []httpx.Instance {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]httpx.Instance(nil), a.instances...)
+}
+
+// Run starts the servers one after the other, a server implementing
+// eprobe.Eprobe must pass its startup probe before the next one starts. It
+// blocks until the context is done, a signal is received, Stop is called or
+// a server fails, then stops the started servers in the reverse order. It
+// returns the first error of the servers, nil after a clean shutdown: the
+// error of the context is only ignored once the application is stopped.
+func (a *App) Run() error {
+	ctx, cancel := context.WithCancel(NewContext(a.opts.ctx, a))
+	defer cancel()
+	if len(a.opts.signals) > 0 {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, a.opts.signals...)
+		defer stop()
+	}
+	a.mu.Lock()
+	a.cancel = cancel
+	a.mu.Unlock()
+
+	// the servers stop on the first failure, runCtx is only done when the
+	// caller stops the application
+	runCtx := ctx
+	eg, ctx := errgroup.WithContext(runCtx)
+	started := make([]httpx.Server, 0, len(a.opts.servers))
+	for _, srv := range a.opts.servers {
+		srv := srv
+		done := make(chan error, 1)
+		eg.Go(func() error {
+			err := srv.Start(ctx)
+			done <- err
+			return err
+		})
+		started = append(started, srv)
+		if err := a.waitStartup(ctx, srv, done); err != nil {
+			if ctx.Err() == nil {
+				eg.Go(func() error { return err })
+			}
+			break
+		}
+		if ins, ok := srv.(httpx.Instance); ok {
+			a.mu.Lock()
+			a.instances = append(a.instances, ins)
+			a.mu.Unlock()
+		}
+	}
+	a.opts.logger.Warnf("[APP] started id:%s name:%s version:%s servers:%d", a.opts.id, a.opts.name, a.opts.version, len(started))
+
+	eg.Go(func() error {
+		<-ctx.Done()
+		var err error
+		for i := len(started) - 1; i >= 0; i-- {
+			stopCtx, stopCancel := context.WithTimeout(NewContext(context.Background(), a), a.opts.stopTimeout)
+			if stopErr := started[i].Stop(stopCtx); stopErr != nil {
+				a.opts.logger.Errorf("[APP] stop server error: %v", stopErr)
+				if err == nil {
+					err = stopErr
+				}
+			}
+			stopCancel()
+		}
+		return err
+	})
+
+	err := eg.Wait()
+	a.opts.logger.Warnf("[APP] stopped id:%s name:%s version:%s err:%v", a.opts.id, a.opts.name, a.opts.version, err)
+	if runCtx.Err() != nil && errors.Is(err, runCtx.Err()) {
+		return nil
+	}
+	return err
+}
+
+// Stop stops a running application, Run returns once the servers stopped.
+func (a *App) Stop() {
+	a.mu.Lock()
+	cancel := a.cancel
+	a.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// waitStartup waits for a server to pass its startup probe or to return, a
+// server returning before it passed the probe failed to start.
+func (a *App) waitStartup(ctx context.Context, srv httpx.Server, done <-chan error) error {
+	probe, ok := srv.(eprobe.Eprobe)
+	if !ok {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(a.opts.startTimeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for probe.StartupProbe() != eprobe.EprobeStateOK {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-done:
+			switch {
+			case err != nil:
+				return err
+			case probe.StartupProbe() == eprobe.EprobeStateOK:
+				return nil
+			case ctx.Err() != nil:
+				return ctx.Err()
+			}
+			return errServerStartup
+		case <-timer.C:
+			return fmt.Errorf("app: server startup timeout after %s", a.opts.startTimeout)
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+type appKey struct{}
+
+// NewContext returns a context carrying the application, the servers get
+// it in Start and Stop.
+func NewContext(ctx context.Context, a *App) context.Context {
+	return context.WithValue(ctx, appKey{}, a)
+}
+
+// FromContext returns the application of a context.
+func FromContext(ctx context.Context) (*App, bool) {
+	a, ok := ctx.Value(appKey{}).(*App)
+	return a, ok
+}
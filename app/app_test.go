@@ -0,0 +1,226 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"pkgx/eprobe"
+	"pkgx/httpx"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder records the events of the servers.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+// probeServer passes its startup probe after a delay.
+type probeServer struct {
+	eprobe.DefaultEprobe
+	name    string
+	rec     *recorder
+	delay   time.Duration
+	fail    error
+	started int32
+	stop    chan struct{}
+}
+
+func (s *probeServer) Start(ctx context.Context) error {
+	s.rec.add("start " + s.name)
+	if s.fail != nil {
+		return s.fail
+	}
+	time.Sleep(s.delay)
+	atomic.StoreInt32(&s.started, 1)
+	<-s.stop
+	return nil
+}
+
+func (s *probeServer) Stop(ctx context.Context) error {
+	s.rec.add("stop " + s.name)
+	close(s.stop)
+	return nil
+}
+
+func (s *probeServer) StartupProbe() eprobe.EprobeState {
+	if atomic.LoadInt32(&s.started) == 1 {
+		return eprobe.EprobeStateOK
+	}
+	return eprobe.EprobeStateFailure
+}
+
+// exitedServer returns at once without passing its startup probe.
+type exitedServer struct {
+	eprobe.DefaultEprobe
+}
+
+func (*exitedServer) Start(ctx context.Context) error {
+	return nil
+}
+
+func (*exitedServer) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (*exitedServer) StartupProbe() eprobe.EprobeState {
+	return eprobe.EprobeStateFailure
+}
+
+func TestApp_Run(t *testing.T) {
+	rec := &recorder{}
+	first := &probeServer{name: "first", rec: rec, delay: 30 * time.Millisecond, stop: make(chan struct{})}
+	second := &probeServer{name: "second", rec: rec, stop: make(chan struct{})}
+	worker := Worker(func(ctx context.Context) error {
+		a, ok := FromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "svc", a.Name())
+		rec.add("start worker")
+		<-ctx.Done()
+		rec.add("stop worker")
+		return ctx.Err()
+	})
+	srv := httpx.New(httpx.Name("api"), httpx.Version("v1.2.3"), httpx.Address("127.0.0.1:0"), httpx.Signals())
+	srv.Handle().GET("/ping", func(c *httpx.Context) {
+		c.ResponseWithCodeMessage(http.StatusOK, []byte("pong"))
+	})
+
+	a := New(Name("svc"), Version("v1.0.0"), Signals(), Servers(first, second, srv, worker))
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Run()
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(a.Instances()) == 0 || len(rec.get()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("app not started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// the first server is ready before the second starts
+	assert.Equal(t, []string{"start first", "start second", "start worker"}, rec.get())
+
+	instances := a.Instances()
+	if assert.Len(t, instances, 1) {
+		assert.Equal(t, "api", instances[0].Name())
+		assert.Equal(t, "v1.2.3", instances[0].Version())
+	}
+	assert.Equal(t, instances[0].Endpoint(), a.Endpoint())
+	resp, err := http.Get(a.Endpoint()[0] + "/ping")
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	a.Stop()
+	assert.Nil(t, <-done)
+	assert.Equal(t, []string{"start first", "start second", "start worker", "stop worker", "stop second", "stop first"}, rec.get())
+	assert.Equal(t, eprobe.EprobeStateFailure, srv.ReadinessProbe())
+}
+
+func TestApp_RunErrors(t *testing.T) {
+	// a failing server stops the others
+	rec := &recorder{}
+	first := &probeServer{name: "first", rec: rec, stop: make(chan struct{})}
+	errFailed := errors.New("failed")
+	failing := Worker(func(ctx context.Context) error {
+		return errFailed
+	})
+	a := New(Signals(), Servers(first, failing))
+	assert.Equal(t, errFailed, a.Run())
+	assert.Equal(t, []string{"start first", "stop first"}, rec.get())
+
+	// a server that does not start in time stops the application
+	rec = &recorder{}
+	slow := &probeServer{name: "slow", rec: rec, delay: 200 * time.Millisecond, stop: make(chan struct{})}
+	next := &probeServer{name: "next", rec: rec, stop: make(chan struct{})}
+	a = New(Signals(), StartTimeout(20*time.Millisecond), Servers(slow, next))
+	assert.EqualError(t, a.Run(), "app: server startup timeout after 20ms")
+	assert.Equal(t, []string{"start slow", "stop slow"}, rec.get())
+
+	// a server failing before its startup probe passed stops the application
+	rec = &recorder{}
+	broken := &probeServer{name: "broken", rec: rec, fail: errFailed, stop: make(chan struct{})}
+	next = &probeServer{name: "next", rec: rec, stop: make(chan struct{})}
+	a = New(Signals(), Servers(broken, next))
+	assert.Equal(t, errFailed, a.Run())
+	assert.Equal(t, []string{"start broken", "stop broken"}, rec.get())
+
+	// so does a server returning before it passed the probe
+	rec = &recorder{}
+	next = &probeServer{name: "next", rec: rec, stop: make(chan struct{})}
+	a = New(Signals(), Servers(&exitedServer{}, next))
+	assert.EqualError(t, a.Run(), "app: server stopped before startup")
+	assert.Empty(t, rec.get())
+
+	// a server failing with its own canceled context is not a clean shutdown
+	errCanceled := fmt.Errorf("consume: %w", context.Canceled)
+	a = New(Signals(), Servers(Worker(func(ctx context.Context) error {
+		return errCanceled
+	})))
+	assert.Equal(t, errCanceled, a.Run())
+
+	// the parent context stops the application
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	a = New(Signals(), Context(ctx), Servers(Worker(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})))
+	assert.Nil(t, a.Run())
+}
+
+func TestWorker_Restart(t *testing.T) {
+	var runs atomic.Int32
+	worker := Worker(func(ctx context.Context) error {
+		runs.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	// the worker is reused by two applications and by a second run
+	first, second := New(Signals(), Servers(worker)), New(Signals(), Servers(worker))
+	done := make(chan error, 2)
+	go func() { done <- first.Run() }()
+	go func() { done <- second.Run() }()
+	for runs.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	first.Stop()
+	second.Stop()
+	assert.Nil(t, <-done)
+	assert.Nil(t, <-done)
+
+	go func() { done <- first.Run() }()
+	for runs.Load() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	first.Stop()
+	assert.Nil(t, <-done)
+
+	// a worker whose context is done does not run
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Nil(t, worker.Start(ctx))
+	assert.Nil(t, worker.Stop(context.Background()))
+	assert.Equal(t, int32(3), runs.Load())
+}
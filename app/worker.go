@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"pkgx/httpx"
+	"sync"
+)
+
+// worker runs a function as a server.
+type worker struct {
+	fn func(ctx context.Context) error
+
+	mu   sync.Mutex
+	runs map[chan struct{}]context.CancelFunc
+}
+
+// Worker returns a server running fn until Stop cancels its context, e.g. a
+// consumer or the eprobe server. The error of its context once done is a
+// clean shutdown. It can be started again, e.g. by another App, Stop stops
+// all the running functions.
+func Worker(fn func(ctx context.Context) error) httpx.Server {
+	return &worker{fn: fn, runs: make(map[chan struct{}]context.CancelFunc)}
+}
+
+func (w *worker) Start(ctx context.Context) error {
+	// the App stops the servers whose start is pending with their context
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	w.runs[done] = cancel
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.runs, done)
+		w.mu.Unlock()
+		cancel()
+		close(done)
+	}()
+
+	err := w.fn(ctx)
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil
+	}
+	return err
+}
+
+// Stop cancels the contexts of the running functions and waits for them to
+// return.
+func (w *worker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	runs := make(map[chan struct{}]context.CancelFunc, len(w.runs))
+	for done, cancel := range w.runs {
+		runs[done] = cancel
+	}
+	w.mu.Unlock()
+
+	for _, cancel := range runs {
+		cancel()
+	}
+	for done := range runs {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -33,3 +33,11 @@ func (s *CacheStat) IncrementHit() {
 func (s *CacheStat) IncrementMiss() {
 	atomic.AddUint64(&s.miss, 1)
 }
+
+func (s *CacheStat) Hit() uint64 {
+	return atomic.LoadUint64(&s.hit)
+}
+
+func (s *CacheStat) Miss() uint64 {
+	return atomic.LoadUint64(&s.miss)
+}
@@ -24,9 +24,9 @@ type TimingWheel[K any, V any] struct {
 	setChannel     chan *timingEntry[K, V]
 	removeChannel  chan K
 	runningChannel chan *timingEntry[K, V]
-	stopChannel    chan bool
+	stopChannel    chan bool // 关闭后 run 与 worker 退出
+	stopOnce       sync.Once
 	taskPosition   sync.Map
-	running        bool
 }
 
 type timingEntry[K any, V any] struct {
@@ -63,7 +63,6 @@ func NewTimingWheel[K any, V any](interval time.Duration, numSlots int, execute
 
 	tw.initSlots()
 	go tw.run()
-	tw.running = true
 	return tw
 }
 
@@ -74,7 +73,7 @@ func (tw *TimingWheel[K, V]) initSlots() {
 }
 
 func (tw *TimingWheel[K, V]) SetTimer(key K, value V, delay time.Duration) error {
-	if !tw.running {
+	if tw.stopped() {
 		return ErrNotRunning
 	}
 
@@ -92,17 +91,21 @@ func (tw *TimingWheel[K, V]) SetTimer(key K, value V, delay time.Duration) error
 		return nil
 	}
 
-	tw.setChannel <- task
-	return nil
+	select {
+	case tw.setChannel <- task:
+		return nil
+	case <-tw.stopChannel:
+		return ErrNotRunning
+	}
 }
 
 func (tw *TimingWheel[K, V]) RemoveTimer(key K) error {
-	if !tw.running {
+	select {
+	case tw.removeChannel <- key:
+		return nil
+	case <-tw.stopChannel:
 		return ErrNotRunning
 	}
-
-	tw.removeChannel <- key
-	return nil
 }
 
 func (tw *TimingWheel[K, V]) run() {
@@ -117,6 +120,7 @@ func (tw *TimingWheel[K, V]) run() {
 			tw.removeTask(key)
 		case <-tw.stopChannel:
 			tw.timer.Stop()
+			return
 		}
 	}
 }
@@ -196,7 +200,10 @@ func (tw *TimingWheel[K, V]) moveTask(base baseEntry[K]) {
 }
 
 func (tw *TimingWheel[K, V]) push(task *timingEntry[K, V]) {
-	tw.runningChannel <- task
+	select {
+	case tw.runningChannel <- task:
+	case <-tw.stopChannel:
+	}
 }
 
 func (tw *TimingWheel[K, V]) workerStart() {
@@ -208,8 +215,9 @@ func (tw *TimingWheel[K, V]) workerStart() {
 					go func() {
 						tw.execute(task.key, task.value)
 					}()
+				case <-tw.stopChannel:
+					return
 				}
-
 			}
 		}()
 	}
@@ -246,7 +254,29 @@ func (tw *TimingWheel[K, V]) getPositionAndCircle(d time.Duration) (pos, circle
 	return
 }
 
+// Len returns the number of pending timers.
+func (tw *TimingWheel[K, V]) Len() int {
+	n := 0
+	tw.taskPosition.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func (tw *TimingWheel[K, V]) stopped() bool {
+	select {
+	case <-tw.stopChannel:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the timing wheel and its workers, the pending timers are
+// dropped and the running ones finish. It may be called more than once.
 func (tw *TimingWheel[K, V]) Close() {
-	tw.stopChannel <- true
-	tw.running = false
+	tw.stopOnce.Do(func() {
+		close(tw.stopChannel)
+	})
 }
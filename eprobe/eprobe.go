@@ -92,6 +92,11 @@ func New(ctx context.Context, opts ...ServerOption) *eprobeServer {
 	return srv
 }
 
+// Handle registers another handler on the probe server, e.g. the metrics.
+func (s *eprobeServer) Handle(pattern string, handler http.Handler) {
+	s.handler.Handle(pattern, handler)
+}
+
 func (s *eprobeServer) Detect(p Eprobe) error {
 	var err error
 
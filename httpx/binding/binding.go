@@ -0,0 +1,76 @@
+package binding
+
+import "net/http"
+
+// Content types of the request bodies
+const (
+	MIMEJSON              = "application/json"
+	MIMEXML               = "application/xml"
+	MIMEXML2              = "text/xml"
+	MIMEPOSTForm          = "application/x-www-form-urlencoded"
+	MIMEMultipartPOSTForm = "multipart/form-data"
+	MIMEPROTOBUF          = "application/x-protobuf"
+)
+
+// Binding decodes a request into a struct and validates it.
+type Binding interface {
+	Name() string
+	Bind(*http.Request, any) error
+}
+
+// BindingUri decodes the path parameters of a request into a struct and validates it.
+type BindingUri interface {
+	Name() string
+	BindUri(map[string][]string, any) error
+}
+
+// StructValidator validates the decoded requests.
+type StructValidator interface {
+	// ValidateStruct validates a struct, a pointer to a struct or a slice
+	// or array of them, other values are valid.
+	ValidateStruct(any) error
+}
+
+// Validator is the validator of every binding, it can be replaced by an
+// implementation over another validation library, or set to nil to turn
+// the validation off.
+var Validator StructValidator = &defaultValidator{}
+
+var (
+	JSON          = jsonBinding{}
+	XML           = xmlBinding{}
+	Form          = formBinding{}
+	Query         = queryBinding{}
+	FormPost      = formPostBinding{}
+	FormMultipart = formMultipartBinding{}
+	ProtoBuf      = protobufBinding{}
+	Header        = headerBinding{}
+	Uri           = uriBinding{}
+)
+
+// Default returns the binding of a request method and Content-Type.
+func Default(method, contentType string) Binding {
+	if method == http.MethodGet {
+		return Form
+	}
+
+	switch contentType {
+	case MIMEJSON:
+		return JSON
+	case MIMEXML, MIMEXML2:
+		return XML
+	case MIMEPROTOBUF:
+		return ProtoBuf
+	case MIMEMultipartPOSTForm:
+		return FormMultipart
+	default: // case MIMEPOSTForm:
+		return Form
+	}
+}
+
+func validate(obj any) error {
+	if Validator == nil {
+		return nil
+	}
+	return Validator.ValidateStruct(obj)
+}
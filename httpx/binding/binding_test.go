@@ -0,0 +1,137 @@
+package binding
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type page struct {
+	Page int `form:"page,default=1" binding:"min=1"`
+	Size int `form:"size,default=20" binding:"max=100"`
+}
+
+type search struct {
+	page
+	Query   string        `form:"q" binding:"required"`
+	Tags    []string      `form:"tag"`
+	Since   *time.Time    `form:"since"`
+	Timeout time.Duration `form:"timeout"`
+	Exact   bool
+	Ignored string `form:"-"`
+}
+
+func TestQuery_Bind(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/?q=go&tag=a&tag=b&since=2022-01-02T15:04:05Z&timeout=2s&Exact=true&Ignored=x", nil)
+	var s search
+	assert.Nil(t, Query.Bind(req, &s))
+	assert.Equal(t, "go", s.Query)
+	assert.Equal(t, []string{"a", "b"}, s.Tags)
+	assert.Equal(t, time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC), *s.Since)
+	assert.Equal(t, 2*time.Second, s.Timeout)
+	assert.True(t, s.Exact)
+	assert.Empty(t, s.Ignored)
+	assert.Equal(t, page{Page: 1, Size: 20}, s.page)
+
+	s = search{}
+	err := Query.Bind(httptest.NewRequest(http.MethodGet, "/?page=0&size=500", nil), &s)
+	assert.Equal(t, ValidationErrors{
+		{Field: "Page", Rule: "min", Param: "1"},
+		{Field: "Size", Rule: "max", Param: "100"},
+		{Field: "Query", Rule: "required"},
+	}, err)
+	assert.Nil(t, s.Since)
+
+	assert.NotNil(t, Query.Bind(httptest.NewRequest(http.MethodGet, "/?q=go&page=x", nil), &s))
+	assert.Equal(t, errNotStructPointer, Query.Bind(req, s))
+}
+
+type user struct {
+	Name    string    `json:"name" form:"name" binding:"required,max=5"`
+	Role    string    `json:"role" form:"role" binding:"omitempty,oneof=admin user"`
+	Age     *int      `json:"age" form:"age" binding:"omitempty,min=18"`
+	Friends []friend  `json:"friends"`
+	Emails  [2]string `json:"-" form:"email"`
+}
+
+type friend struct {
+	ID int `json:"id" binding:"required"`
+}
+
+func TestJSON_Bind(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"ann","age":20,"friends":[{"id":1}]}`))
+	var u user
+	assert.Nil(t, JSON.Bind(req, &u))
+	assert.Equal(t, 20, *u.Age)
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"annabel","role":"root","age":12,"friends":[{"id":1},{}]}`))
+	err := JSON.Bind(req, &user{})
+	assert.Equal(t, ValidationErrors{
+		{Field: "Name", Rule: "max", Param: "5"},
+		{Field: "Role", Rule: "oneof", Param: "admin user"},
+		{Field: "Age", Rule: "min", Param: "18"},
+		{Field: "Friends[1].ID", Rule: "required"},
+	}, err)
+	assert.Equal(t, `binding: field Name failed on the "max=5" rule`, err.(ValidationErrors)[0].Error())
+}
+
+func TestForm_Bind(t *testing.T) {
+	form := url.Values{"name": {"bob"}, "age": {"30"}, "email": {"a@x", "b@x"}}
+	req := httptest.NewRequest(http.MethodPost, "/?role=admin", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", MIMEPOSTForm)
+
+	var u user
+	assert.Equal(t, Form, Default(req.Method, MIMEPOSTForm))
+	assert.Nil(t, Form.Bind(req, &u))
+	assert.Equal(t, "admin", u.Role)
+	assert.Equal(t, 30, *u.Age)
+	assert.Equal(t, [2]string{"a@x", "b@x"}, u.Emails)
+
+	// the query is not part of the posted form
+	u = user{}
+	assert.Nil(t, FormPost.Bind(req, &u))
+	assert.Empty(t, u.Role)
+}
+
+func TestHeader_Bind(t *testing.T) {
+	var h struct {
+		RequestID string `header:"x-request-id" binding:"len=4"`
+		Limit     uint8  `header:"X-Limit"`
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-Id", "abcd")
+	req.Header.Set("X-Limit", "300")
+	assert.NotNil(t, Header.Bind(req, &h))
+
+	req.Header.Set("X-Limit", "30")
+	assert.Nil(t, Header.Bind(req, &h))
+	assert.Equal(t, "abcd", h.RequestID)
+	assert.Equal(t, uint8(30), h.Limit)
+}
+
+func TestValidator(t *testing.T) {
+	RegisterRule("even", func(field reflect.Value, _ string) bool {
+		return field.Int()%2 == 0
+	})
+	type number struct {
+		N int `binding:"even"`
+	}
+	err := Validator.ValidateStruct([]*number{{N: 2}, {N: 3}, nil})
+	assert.Equal(t, ValidationErrors{{Field: "[1].N", Rule: "even"}}, err)
+
+	var unknown struct {
+		N int `binding:"odd"`
+	}
+	assert.EqualError(t, Validator.ValidateStruct(&unknown), `binding: unknown rule "odd" on field N`)
+
+	// the validation can be turned off
+	defer func(v StructValidator) { Validator = v }(Validator)
+	Validator = nil
+	assert.Nil(t, JSON.Bind(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`)), &user{}))
+}
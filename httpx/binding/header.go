@@ -0,0 +1,25 @@
+package binding
+
+import (
+	"net/http"
+	"net/textproto"
+)
+
+type headerBinding struct{}
+
+func (headerBinding) Name() string {
+	return "header"
+}
+
+// Bind decodes the header fields named by the `header` tags, the names are
+// case-insensitive.
+func (headerBinding) Bind(req *http.Request, obj any) error {
+	err := mapping(obj, func(key string) ([]string, bool) {
+		values, ok := req.Header[textproto.CanonicalMIMEHeaderKey(key)]
+		return values, ok
+	}, "header")
+	if err != nil {
+		return err
+	}
+	return validate(obj)
+}
@@ -0,0 +1,28 @@
+package binding
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+type jsonBinding struct{}
+
+func (jsonBinding) Name() string {
+	return "json"
+}
+
+func (jsonBinding) Bind(req *http.Request, obj any) error {
+	if req == nil || req.Body == nil {
+		return errors.New("binding: invalid request")
+	}
+	return decodeJSON(req.Body, obj)
+}
+
+func decodeJSON(r io.Reader, obj any) error {
+	if err := json.NewDecoder(r).Decode(obj); err != nil {
+		return err
+	}
+	return validate(obj)
+}
@@ -0,0 +1,228 @@
+package binding
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errNotStructPointer = errors.New("binding: obj must be a non-nil pointer to a struct")
+
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// lookupFunc returns the values of a key of the request.
+type lookupFunc func(key string) ([]string, bool)
+
+func mapForm(ptr any, form map[string][]string) error {
+	return mapFormByTag(ptr, form, "form")
+}
+
+func mapFormByTag(ptr any, form map[string][]string, tag string) error {
+	return mapping(ptr, func(key string) ([]string, bool) {
+		values, ok := form[key]
+		return values, ok
+	}, tag)
+}
+
+// mapping sets the fields of the struct ptr points to from the values named
+// by their tags, `form:"name,default=1"`. A field without a tag is looked up
+// by its name, a tag "-" skips it, the fields of an untagged struct field
+// are mapped in turn.
+func mapping(ptr any, lookup lookupFunc, tag string) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errNotStructPointer
+	}
+	_, err := mapStruct(v.Elem(), lookup, tag)
+	return err
+}
+
+func mapStruct(v reflect.Value, lookup lookupFunc, tag string) (bool, error) {
+	var set bool
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		ok, err := mapField(v.Field(i), sf, lookup, tag)
+		if err != nil {
+			return false, err
+		}
+		set = set || ok
+	}
+	return set, nil
+}
+
+// mapField sets a field, it reports whether a value was found.
+func mapField(value reflect.Value, field reflect.StructField, lookup lookupFunc, tag string) (bool, error) {
+	name, opts, _ := strings.Cut(field.Tag.Get(tag), ",")
+	if name == "-" {
+		return false, nil
+	}
+
+	// a nil pointer is only allocated when a value is found
+	if value.Kind() == reflect.Pointer {
+		ptr := value
+		if ptr.IsNil() {
+			ptr = reflect.New(value.Type().Elem())
+		}
+		ok, err := mapField(ptr.Elem(), field, lookup, tag)
+		if ok && value.IsNil() {
+			value.Set(ptr)
+		}
+		return ok, err
+	}
+
+	if name == "" && value.Kind() == reflect.Struct && !isScalar(value) {
+		return mapStruct(value, lookup, tag)
+	}
+	if !field.IsExported() {
+		return false, nil
+	}
+	if name == "" {
+		name = field.Name
+	}
+
+	values, ok := lookup(name)
+	if !ok || len(values) == 0 {
+		def, found := defaultValue(opts)
+		if !found {
+			return false, nil
+		}
+		values = []string{def}
+	}
+
+	switch value.Kind() {
+	case reflect.Slice:
+		if isScalar(value) {
+			break
+		}
+		slice := reflect.MakeSlice(value.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), s); err != nil {
+				return false, fmt.Errorf("binding: field %s: %w", field.Name, err)
+			}
+		}
+		value.Set(slice)
+		return true, nil
+	case reflect.Array:
+		if len(values) != value.Len() {
+			return false, fmt.Errorf("binding: field %s: %d values for %s", field.Name, len(values), value.Type())
+		}
+		for i, s := range values {
+			if err := setValue(value.Index(i), s); err != nil {
+				return false, fmt.Errorf("binding: field %s: %w", field.Name, err)
+			}
+		}
+		return true, nil
+	}
+
+	if err := setValue(value, values[0]); err != nil {
+		return false, fmt.Errorf("binding: field %s: %w", field.Name, err)
+	}
+	return true, nil
+}
+
+// defaultValue returns the default=value option of a tag.
+func defaultValue(opts string) (string, bool) {
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if strings.HasPrefix(opt, "default=") {
+			return opt[len("default="):], true
+		}
+	}
+	return "", false
+}
+
+// isScalar reports whether a value is set from a single string.
+func isScalar(value reflect.Value) bool {
+	return reflect.PointerTo(value.Type()).Implements(textUnmarshalerType)
+}
+
+// setValue sets a value from a string, an empty string sets a number or a
+// boolean to zero.
+func setValue(value reflect.Value, s string) error {
+	if value.Kind() == reflect.Pointer {
+		ptr := reflect.New(value.Type().Elem())
+		if err := setValue(ptr.Elem(), s); err != nil {
+			return err
+		}
+		value.Set(ptr)
+		return nil
+	}
+
+	if isScalar(value) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if value.Type() == durationType {
+		if s == "" {
+			value.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+		return nil
+	case reflect.Interface:
+		if value.NumMethod() == 0 {
+			value.Set(reflect.ValueOf(s))
+			return nil
+		}
+	}
+
+	if s == "" {
+		switch value.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+			value.Set(reflect.Zero(value.Type()))
+			return nil
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
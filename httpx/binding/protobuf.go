@@ -0,0 +1,32 @@
+package binding
+
+import (
+	"errors"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"net/http"
+)
+
+type protobufBinding struct{}
+
+func (protobufBinding) Name() string {
+	return "protobuf"
+}
+
+func (protobufBinding) Bind(req *http.Request, obj any) error {
+	if req == nil || req.Body == nil {
+		return errors.New("binding: invalid request")
+	}
+	msg, ok := obj.(proto.Message)
+	if !ok {
+		return errors.New("binding: obj is not a proto.Message")
+	}
+	buf, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(buf, msg); err != nil {
+		return err
+	}
+	return validate(obj)
+}
@@ -0,0 +1,15 @@
+package binding
+
+type uriBinding struct{}
+
+func (uriBinding) Name() string {
+	return "uri"
+}
+
+// BindUri decodes the path parameters named by the `uri` tags.
+func (uriBinding) BindUri(params map[string][]string, obj any) error {
+	if err := mapFormByTag(obj, params, "uri"); err != nil {
+		return err
+	}
+	return validate(obj)
+}
@@ -0,0 +1,292 @@
+package binding
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// RuleFunc reports whether a field satisfies a rule, param is the text after
+// the '=' of the rule, e.g. "1" for min=1.
+type RuleFunc func(field reflect.Value, param string) bool
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]RuleFunc{
+		"required": hasValue,
+		"min": func(field reflect.Value, param string) bool {
+			c, ok := compare(field, param)
+			return ok && c >= 0
+		},
+		"max": func(field reflect.Value, param string) bool {
+			c, ok := compare(field, param)
+			return ok && c <= 0
+		},
+		"len": func(field reflect.Value, param string) bool {
+			c, ok := compare(field, param)
+			return ok && c == 0
+		},
+		"oneof": isOneOf,
+	}
+)
+
+// RegisterRule adds a rule to the `binding` tags of the default validator,
+// or replaces one.
+func RegisterRule(name string, fn RuleFunc) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[name] = fn
+}
+
+func lookupRule(name string) RuleFunc {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	return rules[name]
+}
+
+// FieldError is a field that failed a rule.
+type FieldError struct {
+	// Field is the path of the field, e.g. Items[0].Name
+	Field string
+	// Rule is the name of the failed rule and Param its parameter.
+	Rule  string
+	Param string
+}
+
+func (e *FieldError) Error() string {
+	rule := e.Rule
+	if e.Param != "" {
+		rule += "=" + e.Param
+	}
+	return fmt.Sprintf("binding: field %s failed on the %q rule", e.Field, rule)
+}
+
+// ValidationErrors are the fields of a struct that failed their rules.
+type ValidationErrors []*FieldError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// defaultValidator checks the comma separated rules of the `binding` tags:
+//
+//	required   the field is not a zero value, or a nil slice, map or pointer
+//	omitempty  the other rules are skipped for a zero value
+//	min=n      the number, the length of a string, slice or map is at least n
+//	max=n      the number or the length is at most n
+//	len=n      the number or the length is n
+//	oneof=a b  the string or the number is one of the space separated values
+//
+// The rules of a pointer apply to the value it points to, a nil pointer
+// only fails required. Nested structs and the structs of slices, arrays and
+// maps are validated in turn.
+type defaultValidator struct {
+	cache sync.Map // reflect.Type -> []fieldRules
+}
+
+// fieldRules are the parsed rules of a field.
+type fieldRules struct {
+	index    int
+	name     string
+	embedded bool
+	rules    []rule
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+var _ StructValidator = &defaultValidator{}
+
+func (v *defaultValidator) ValidateStruct(obj any) error {
+	if obj == nil {
+		return nil
+	}
+	var errs ValidationErrors
+	if err := v.validate(reflect.ValueOf(obj), "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validate collects the fields of a value that fail their rules, it returns
+// an error for an unknown rule.
+func (v *defaultValidator) validate(value reflect.Value, path string, errs *ValidationErrors) error {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		return v.validateStruct(value, path, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := v.validate(value.Index(i), fmt.Sprintf("%s[%d]", path, i), errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			if err := v.validate(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *defaultValidator) validateStruct(value reflect.Value, path string, errs *ValidationErrors) error {
+	if path != "" {
+		path += "."
+	}
+	for _, f := range v.fields(value.Type()) {
+		field := value.Field(f.index)
+		failed := false
+		for _, r := range f.rules {
+			if r.name == "omitempty" {
+				if !hasValue(field, "") {
+					break
+				}
+				continue
+			}
+
+			fn := lookupRule(r.name)
+			if fn == nil {
+				return fmt.Errorf("binding: unknown rule %q on field %s%s", r.name, path, f.name)
+			}
+			target := field
+			if r.name != "required" {
+				for target.Kind() == reflect.Pointer && !target.IsNil() {
+					target = target.Elem()
+				}
+				if target.Kind() == reflect.Pointer {
+					continue
+				}
+			}
+			if !fn(target, r.param) {
+				*errs = append(*errs, &FieldError{Field: path + f.name, Rule: r.name, Param: r.param})
+				failed = true
+				break
+			}
+		}
+		if failed {
+			continue
+		}
+		// the fields of an embedded struct are promoted
+		inner := path + f.name
+		if f.embedded {
+			inner = strings.TrimSuffix(path, ".")
+		}
+		if err := v.validate(field, inner, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fields returns the rules of the exported and embedded fields of a struct type.
+func (v *defaultValidator) fields(t reflect.Type) []fieldRules {
+	if cached, ok := v.cache.Load(t); ok {
+		return cached.([]fieldRules)
+	}
+
+	fields := make([]fieldRules, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("binding")
+		if !sf.IsExported() && !sf.Anonymous || tag == "-" {
+			continue
+		}
+		f := fieldRules{index: i, name: sf.Name, embedded: sf.Anonymous}
+		if tag != "" {
+			for _, s := range strings.Split(tag, ",") {
+				name, param, _ := strings.Cut(strings.TrimSpace(s), "=")
+				f.rules = append(f.rules, rule{name: name, param: param})
+			}
+		}
+		fields = append(fields, f)
+	}
+	v.cache.Store(t, fields)
+	return fields
+}
+
+// hasValue reports whether a field is not a zero value, or a nil slice, map
+// or pointer.
+func hasValue(field reflect.Value, _ string) bool {
+	switch field.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Pointer, reflect.Interface, reflect.Chan, reflect.Func:
+		return !field.IsNil()
+	case reflect.Invalid:
+		return false
+	default:
+		return !field.IsZero()
+	}
+}
+
+// compare compares the number, or the length, of a field with param, it
+// reports false if they cannot be compared.
+func compare(field reflect.Value, param string) (int, bool) {
+	p, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	var n float64
+	switch field.Kind() {
+	case reflect.String:
+		n = float64(utf8.RuneCountInString(field.String()))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n = float64(field.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = field.Float()
+	default:
+		return 0, false
+	}
+
+	switch {
+	case n < p:
+		return -1, true
+	case n > p:
+		return 1, true
+	}
+	return 0, true
+}
+
+func isOneOf(field reflect.Value, param string) bool {
+	var s string
+	switch field.Kind() {
+	case reflect.String:
+		s = field.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(field.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(field.Uint(), 10)
+	default:
+		return false
+	}
+	for _, v := range strings.Fields(param) {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
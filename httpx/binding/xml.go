@@ -0,0 +1,23 @@
+package binding
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+)
+
+type xmlBinding struct{}
+
+func (xmlBinding) Name() string {
+	return "xml"
+}
+
+func (xmlBinding) Bind(req *http.Request, obj any) error {
+	if req == nil || req.Body == nil {
+		return errors.New("binding: invalid request")
+	}
+	if err := xml.NewDecoder(req.Body).Decode(obj); err != nil {
+		return err
+	}
+	return validate(obj)
+}
@@ -1,7 +1,9 @@
 package client
 
 import (
+	"context"
 	"net/http"
+	"pkgx/httpx/trace"
 	"sync"
 )
 
@@ -38,3 +40,24 @@ func (c *HeaderCall) Add(key string, value string) {
 	defer c.mu.Unlock()
 	c.header[key] = value
 }
+
+type traceCall struct {
+	EmptyCall
+	sc trace.SpanContext
+}
+
+// TraceCall forwards the request ID and the trace context of ctx, e.g. the
+// request context of a handler behind middleware.RequestID, a new trace is
+// started without one.
+func TraceCall(ctx context.Context) CallOption {
+	sc, ok := trace.FromContext(ctx)
+	if !ok {
+		sc = trace.New()
+	}
+	return &traceCall{sc: sc}
+}
+
+func (c *traceCall) Header(header *http.Header) error {
+	c.sc.Inject(*header)
+	return nil
+}
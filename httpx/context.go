@@ -2,12 +2,19 @@ package httpx
 
 import (
 	"context"
+	"errors"
+	"io"
 	"io/ioutil"
 	"math"
+	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"pkgx/httpx/binding"
 	"pkgx/httpx/render"
+	"pkgx/httpx/websocket"
 	"strings"
 	"sync"
 )
@@ -66,6 +73,9 @@ type Context struct {
 
 	// 路由查找时如有param类型时直接挑选匹配节点
 	skippedNodes *[]skippedNode
+
+	// the request context before the Timeout middlewares, see LiftTimeout
+	untimed context.Context
 }
 
 func (c *Context) reset() {
@@ -75,6 +85,9 @@ func (c *Context) reset() {
 	c.sameSite = http.SameSiteDefaultMode
 	c.Keys = nil
 	c.fullPath = ""
+	c.queryCache = nil
+	c.formCache = nil
+	c.untimed = nil
 	c.Params = c.Params[:0]
 	*c.params = (*c.params)[:0]
 	*c.skippedNodes = (*c.skippedNodes)[:0]
@@ -163,10 +176,122 @@ func (c *Context) initFormCache() {
 	}
 }
 
+// FormFile returns the first file of a multipart form field, the form is
+// parsed within MaxMultipartMemory.
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	if c.Request.MultipartForm == nil {
+		if err := c.Request.ParseMultipartForm(c.router.MaxMultipartMemory); err != nil {
+			return nil, err
+		}
+	}
+	f, fh, err := c.Request.FormFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return fh, nil
+}
+
+// MultipartForm returns the parsed multipart form, including the files.
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	err := c.Request.ParseMultipartForm(c.router.MaxMultipartMemory)
+	return c.Request.MultipartForm, err
+}
+
+// SaveUploadedFile saves an uploaded file to dst, the directories of dst
+// are created.
+func (c *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// File writes a file of the local file system, Range and conditional
+// requests are answered by http.ServeFile. The timeout is lifted, see
+// LiftTimeout.
+func (c *Context) File(filepath string) {
+	c.LiftTimeout()
+	http.ServeFile(c.Writer, c.Request, filepath)
+}
+
+// FileFromFS writes a file of a file system like File, the timeout is only
+// lifted for an existing file.
+func (c *Context) FileFromFS(filepath string, fs http.FileSystem) {
+	if !serveFile(c, fs, filepath) {
+		c.ResponseWithCodeMessage(http.StatusNotFound, Default404Body)
+	}
+}
+
 func (c *Context) GetParam(key string) string {
 	return c.Params.ByName(key)
 }
 
+// Bind decodes the request into obj with the binding of its method and
+// Content-Type, then validates obj with binding.Validator.
+func (c *Context) Bind(obj any) error {
+	return c.BindWith(obj, binding.Default(c.Request.Method, c.ContentType()))
+}
+
+// BindJSON decodes a JSON body into obj and validates it.
+func (c *Context) BindJSON(obj any) error {
+	return c.BindWith(obj, binding.JSON)
+}
+
+// BindXML decodes an XML body into obj and validates it.
+func (c *Context) BindXML(obj any) error {
+	return c.BindWith(obj, binding.XML)
+}
+
+// BindProtobuf decodes a protobuf body into obj, a proto.Message, and validates it.
+func (c *Context) BindProtobuf(obj any) error {
+	return c.BindWith(obj, binding.ProtoBuf)
+}
+
+// BindQuery decodes the query into the `form` tagged fields of obj and validates it.
+func (c *Context) BindQuery(obj any) error {
+	return c.BindWith(obj, binding.Query)
+}
+
+// BindHeader decodes the header into the `header` tagged fields of obj and validates it.
+func (c *Context) BindHeader(obj any) error {
+	return c.BindWith(obj, binding.Header)
+}
+
+// BindUri decodes the path parameters into the `uri` tagged fields of obj and validates it.
+func (c *Context) BindUri(obj any) error {
+	params := make(map[string][]string, len(c.Params))
+	for _, p := range c.Params {
+		params[p.Key] = append(params[p.Key], p.Value)
+	}
+	return binding.Uri.BindUri(params, obj)
+}
+
+// BindWith decodes the request into obj with a binding and validates it,
+// the forms are parsed within MaxMultipartMemory.
+func (c *Context) BindWith(obj any, b binding.Binding) error {
+	if b == binding.Form || b == binding.FormMultipart {
+		if err := c.Request.ParseMultipartForm(c.router.MaxMultipartMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return err
+		}
+	}
+	return b.Bind(c.Request, obj)
+}
+
 func (c *Context) Response(r render.Render) {
 	_, err := c.Writer.Write(r.Parse())
 	if err != nil {
@@ -176,6 +301,67 @@ func (c *Context) Response(r render.Render) {
 	c.Writer.WriteHeaderNow()
 }
 
+// LiftTimeout removes the deadlines of the Timeout middlewares from the
+// request context, e.g. for a long-lived stream: the buffered output is
+// written and the next writes go directly to the client. The values of the
+// context are kept and it is still done when the client goes away. The
+// write timeout of the server still applies, streaming servers set
+// TimeoutWrite(0).
+func (c *Context) LiftTimeout() {
+	if c.untimed != nil {
+		c.Request = c.Request.WithContext(liftedContext{
+			Context: c.Request.Context(),
+			untimed: c.untimed,
+		})
+		c.untimed = nil
+	}
+	if tw, ok := c.Writer.(*timeoutWriter); ok {
+		tw.lift()
+	}
+}
+
+// WrapH returns a HandlerFunc serving a net/http handler, e.g. a download or
+// a proxy. The timeout is lifted, the handler writes its response directly.
+func WrapH(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		c.LiftTimeout()
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// Stream lifts the server timeout and calls step until it returns false or
+// the client goes away, the output of each step is flushed. It reports
+// whether the client went away.
+func (c *Context) Stream(step func(w io.Writer) bool) bool {
+	c.LiftTimeout()
+	clientGone := c.Request.Context().Done()
+	for {
+		select {
+		case <-clientGone:
+			return true
+		default:
+			keepOpen := step(c.Writer)
+			c.Writer.Flush()
+			if !keepOpen {
+				return false
+			}
+		}
+	}
+}
+
+// SSEvent writes and flushes a Server-Sent Event, the headers of the event
+// stream are set with the first event.
+func (c *Context) SSEvent(name string, message any) {
+	c.LiftTimeout()
+	r := render.RenderSSE(name, message)
+	r.WriterContentType(c.Writer)
+	if err := r.Render(c.Writer); err != nil {
+		c.Log.Errorf("http sse write error:%v", err)
+		return
+	}
+	c.Writer.Flush()
+}
+
 func (c *Context) ResponseWithCode(code int) {
 	c.Status(code)
 	c.Writer.WriteHeaderNow()
@@ -272,6 +458,13 @@ func (c *Context) IsWebsocket() bool {
 	return false
 }
 
+// Upgrade answers the WebSocket opening handshake and lifts the server
+// timeout, a bad handshake has been answered with an HTTP error.
+func (c *Context) Upgrade(opts ...websocket.Option) (*websocket.Conn, error) {
+	c.LiftTimeout()
+	return websocket.Upgrade(c.Writer, c.Request, opts...)
+}
+
 func (c *Context) ClientIP() string {
 	remoteIP := net.ParseIP(c.RemoteIP())
 	if len(remoteIP) == 0 {
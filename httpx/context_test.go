@@ -0,0 +1,216 @@
+package httpx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pkgx/httpx/websocket"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext_Bind(t *testing.T) {
+	type path struct {
+		User string `uri:"user" binding:"required"`
+		ID   int    `uri:"id" binding:"min=1"`
+	}
+	type order struct {
+		Item string `json:"item" form:"item" binding:"required"`
+	}
+	type header struct {
+		Trace string `header:"X-Trace-Id"`
+	}
+
+	h := httpHandler()
+	h.WithLogger(DefaultLogger)
+	bind := func(c *Context) {
+		var (
+			uri  path
+			body order
+			head header
+		)
+		if err := c.BindUri(&uri); err != nil {
+			c.ResponseWithCodeMessage(http.StatusNotFound, []byte(err.Error()))
+			return
+		}
+		if err := c.Bind(&body); err != nil {
+			c.ResponseWithCodeMessage(http.StatusBadRequest, []byte(err.Error()))
+			return
+		}
+		_ = c.BindHeader(&head)
+		c.ResponseWithCodeMessage(http.StatusOK, []byte(uri.User+" "+body.Item+" "+head.Trace))
+	}
+	h.GET("/users/:user/orders/:id", bind)
+	h.POST("/users/:user/orders/:id", bind)
+
+	w := serve(h, http.MethodGet, "/users/ann/orders/1?item=book")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ann book ", w.Body.String())
+
+	w = serve(h, http.MethodGet, "/users/ann/orders/0")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `binding: field ID failed on the "min=1" rule`, w.Body.String())
+
+	// a missing field fails the validation
+	w = serve(h, http.MethodGet, "/users/ann/orders/1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/users/bob/orders/2", strings.NewReader(`{"item":"pen"}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-Trace-Id", "t1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bob pen t1", w.Body.String())
+}
+
+func TestContext_FormFile(t *testing.T) {
+	dir := t.TempDir()
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	_ = mw.WriteField("name", "report")
+	fw, _ := mw.CreateFormFile("file", "report.txt")
+	_, _ = fw.Write([]byte("content"))
+	assert.Nil(t, mw.Close())
+
+	h := httpHandler()
+	h.WithLogger(DefaultLogger)
+	h.POST("/upload", func(c *Context) {
+		file, err := c.FormFile("file")
+		if !assert.Nil(t, err) {
+			return
+		}
+		form, err := c.MultipartForm()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"report"}, form.Value["name"])
+
+		_, err = c.FormFile("missing")
+		assert.Equal(t, http.ErrMissingFile, err)
+		assert.Nil(t, c.SaveUploadedFile(file, filepath.Join(dir, "uploads", file.Filename)))
+		c.ResponseWithCode(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	data, err := os.ReadFile(filepath.Join(dir, "uploads", "report.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "content", string(data))
+}
+
+func TestWrapH(t *testing.T) {
+	srv := New(TimeOut(10*time.Millisecond), WithLogger(DefaultLogger))
+	srv.Handle().GET("/download", WrapH(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the handler outlives the server timeout
+		time.Sleep(20 * time.Millisecond)
+		assert.Nil(t, r.Context().Err())
+		w.Header().Set(HeaderContentType, ContentTypeApplicationStream)
+		w.Write([]byte("data"))
+	})))
+
+	w := serve(srv.Handle(), http.MethodGet, "/download")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ContentTypeApplicationStream, w.Header().Get(HeaderContentType))
+	assert.Equal(t, "data", w.Body.String())
+}
+
+func TestContext_Stream(t *testing.T) {
+	srv := New(TimeOut(10*time.Millisecond), WithLogger(DefaultLogger))
+	srv.Handle().GET("/events", func(c *Context) {
+		n := 0
+		gone := c.Stream(func(w io.Writer) bool {
+			// the stream outlives the server timeout
+			time.Sleep(10 * time.Millisecond)
+			if !assert.Nil(t, c.Request.Context().Err()) {
+				return false
+			}
+			n++
+			c.SSEvent("tick", map[string]int{"n": n})
+			return n < 3
+		})
+		assert.False(t, gone)
+		// an event whose data cannot be encoded is logged and skipped
+		assert.NotPanics(t, func() {
+			c.SSEvent("bad", make(chan int))
+		})
+		c.SSEvent("", "bye\nsee you")
+	})
+
+	w := serve(srv.Handle(), http.MethodGet, "/events")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "event:tick\ndata:{\"n\":1}\n\n"+
+		"event:tick\ndata:{\"n\":2}\n\n"+
+		"event:tick\ndata:{\"n\":3}\n\n"+
+		"data:bye\ndata:see you\n\n", w.Body.String())
+
+	// the stream stops when the client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	steps := 0
+	srv.Handle().GET("/gone", func(c *Context) {
+		assert.True(t, c.Stream(func(w io.Writer) bool {
+			steps++
+			cancel()
+			return true
+		}))
+	})
+	srv.Handle().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/gone", nil).WithContext(ctx))
+	assert.Equal(t, 1, steps)
+}
+
+func TestContext_Upgrade(t *testing.T) {
+	srv := New(TimeOut(10*time.Millisecond), WithLogger(DefaultLogger))
+	srv.Handle().GET("/ws", func(c *Context) {
+		conn, err := c.Upgrade()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// the connection outlives the server timeout
+		time.Sleep(20 * time.Millisecond)
+		assert.Nil(t, c.Request.Context().Err())
+		assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte("hi")))
+	})
+	ts := httptest.NewServer(srv.Handle())
+	defer ts.Close()
+
+	assert.Equal(t, http.StatusBadRequest, serve(srv.Handle(), http.MethodGet, "/ws").Code)
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	assert.Nil(t, req.Write(conn))
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	msg, err := io.ReadAll(br)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x81, 2, 'h', 'i'}, msg)
+}
@@ -2,15 +2,25 @@ package httpx
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net"
 	"net/http"
 	"net/url"
-	"sync"
+	"os"
+	"os/signal"
+	"pkgx/eprobe"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 var (
 	Default404Body = []byte("404 page not found")
+	Default405Body = []byte("405 method not allowed")
 	DefaultAddress = ":8080"
 	DefaultLogger  = NewStdLogger()
 )
@@ -31,12 +41,38 @@ type HttpServer struct {
 	//tls certFile、keyFile
 	certFile string
 	keyFile  string
+	// h2c serves HTTP/2 without TLS, http2 configures HTTP/2 with and
+	// without TLS, nextProtos are the ALPN protocols of TLS.
+	h2c        bool
+	http2      *http2.Server
+	nextProtos []string
 
 	middleware HandlersChain
 	logger     Logger
-	wg         sync.WaitGroup
+
+	// lifecycle
+	state         int32
+	drainTimeout  time.Duration
+	shutdownDelay time.Duration
+	signals       []os.Signal
+	onStart       []func(context.Context) error
+	onStop        []func(context.Context) error
 }
 
+// The states of the server lifecycle
+const (
+	stateIdle int32 = iota
+	stateReady
+	stateDraining
+	stateStopped
+)
+
+var (
+	_ Server        = (*HttpServer)(nil)
+	_ Instance      = (*HttpServer)(nil)
+	_ eprobe.Eprobe = (*HttpServer)(nil)
+)
+
 type ServerOption func(srv *HttpServer)
 
 func Name(name string) ServerOption {
@@ -70,6 +106,81 @@ func TlsConfig(certFile, keyFile string) ServerOption {
 	}
 }
 
+// H2C serves HTTP/2 without TLS next to HTTP/1, to the clients with prior
+// knowledge and to the HTTP/1 requests upgraded to h2c.
+func H2C(enable bool) ServerOption {
+	return func(srv *HttpServer) {
+		srv.h2c = enable
+	}
+}
+
+// Http2MaxConcurrentStreams sets the number of concurrent streams of an
+// HTTP/2 connection, 250 by default.
+func Http2MaxConcurrentStreams(n uint32) ServerOption {
+	return func(srv *HttpServer) {
+		srv.http2.MaxConcurrentStreams = n
+	}
+}
+
+// Http2MaxReadFrameSize sets the largest HTTP/2 frame the server reads,
+// between 16KB and 16MB, 1MB by default.
+func Http2MaxReadFrameSize(n uint32) ServerOption {
+	return func(srv *HttpServer) {
+		srv.http2.MaxReadFrameSize = n
+	}
+}
+
+// NextProtos sets the protocols TLS negotiates by ALPN by preference, by
+// default "h2" and "http/1.1". HTTP/2 is disabled over TLS without "h2".
+func NextProtos(protos ...string) ServerOption {
+	return func(srv *HttpServer) {
+		srv.nextProtos = protos
+	}
+}
+
+// DrainTimeout sets how long Stop waits for the active requests, 10s by
+// default. The connections left are closed.
+func DrainTimeout(timeout time.Duration) ServerOption {
+	return func(srv *HttpServer) {
+		srv.drainTimeout = timeout
+	}
+}
+
+// ShutdownDelay sets how long Stop keeps serving once the readiness probe
+// fails, so that the load balancers stop sending requests first.
+func ShutdownDelay(delay time.Duration) ServerOption {
+	return func(srv *HttpServer) {
+		srv.shutdownDelay = delay
+	}
+}
+
+// Signals sets the signals that stop Run, SIGINT and SIGTERM by default.
+// Signals() disables the handling of signals.
+func Signals(signals ...os.Signal) ServerOption {
+	return func(srv *HttpServer) {
+		srv.signals = signals
+	}
+}
+
+// OnStart adds a hook run by Start once the server listens, before it is
+// ready. An error stops the server.
+func OnStart(fn func(ctx context.Context) error) ServerOption {
+	return func(srv *HttpServer) {
+		srv.onStart = append(srv.onStart, fn)
+	}
+}
+
+// OnStop adds a hook run by Stop once the requests are drained, the hooks
+// run in the reverse order of their registration.
+func OnStop(fn func(ctx context.Context) error) ServerOption {
+	return func(srv *HttpServer) {
+		srv.onStop = append(srv.onStop, fn)
+	}
+}
+
+// TimeOut sets a Timeout on all the requests, 1s by default and none with
+// 0. The routes and the groups may set their own shorter ones, the
+// Middleware of the server runs outside of it and sees the timeout responses.
 func TimeOut(timeout time.Duration) ServerOption {
 	return func(srv *HttpServer) {
 		srv.timeOut = timeout
@@ -114,13 +225,16 @@ func New(opts ...ServerOption) *HttpServer {
 		name:         "",
 		version:      "v0.0.0",
 		address:      DefaultAddress,
-		timeOut:      1 * time.Second,
 		readTimeout:  3 * time.Second,
 		writeTimeout: 3 * time.Second,
 		idleTimeout:  7200 * time.Second,
+		timeOut:      1 * time.Second,
 		middleware:   make(HandlersChain, 0),
 		logger:       DefaultLogger,
 		handle:       httpHandler(),
+		http2:        &http2.Server{},
+		drainTimeout: 10 * time.Second,
+		signals:      []os.Signal{syscall.SIGINT, syscall.SIGTERM},
 	}
 	for _, opt := range opts {
 		opt(s)
@@ -132,66 +246,180 @@ func New(opts ...ServerOption) *HttpServer {
 		Handler:      s.handle,
 		ReadTimeout:  s.readTimeout,
 		WriteTimeout: s.writeTimeout,
-		IdleTimeout:  s.IdleTimeout,
+		IdleTimeout:  s.idleTimeout,
 	}
-	s.handle.Use(s.filter())
+	s.configureHttp2()
 	s.handle.Use(s.middleware...)
+	if s.timeOut > 0 {
+		s.handle.Use(Timeout(s.timeOut))
+	}
 	return s
 }
 
+// configureHttp2 applies the HTTP/2 settings to TLS and h2c.
+func (srv *HttpServer) configureHttp2() {
+	if srv.http2.IdleTimeout == 0 {
+		srv.http2.IdleTimeout = srv.idleTimeout
+	}
+	if err := http2.ConfigureServer(&srv.Server, srv.http2); err != nil {
+		srv.logger.Errorf("[HTTP] configure http2 error: %v", err)
+	}
+	if len(srv.nextProtos) > 0 {
+		srv.Server.TLSConfig.NextProtos = srv.nextProtos
+	}
+	if srv.h2c {
+		srv.Server.Handler = h2c.NewHandler(srv.handle, srv.http2)
+	}
+}
+
 func (srv *HttpServer) Handle() Handler {
 	return srv.handle
 }
 
-func (srv *HttpServer) Run(ctx context.Context) (err error) {
-	srv.wg.Add(2)
-	go func() {
-		srv.wg.Done()
-		err = srv.Start(ctx)
-	}()
+// Run starts the server and blocks until ctx is done, a signal is received
+// or the server fails, then stops it gracefully. It returns the error of
+// the server or of the shutdown, nil after a clean shutdown.
+func (srv *HttpServer) Run(ctx context.Context) error {
+	if len(srv.signals) > 0 {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, srv.signals...)
+		defer stop()
+	}
+
+	errCh := make(chan error, 1)
 	go func() {
-		srv.wg.Done()
-		err = srv.Stop(ctx)
+		errCh <- srv.Start(ctx)
 	}()
-	srv.wg.Wait()
 
-	srv.logger.Warnf("[HTTP] server listening on:%s, uuid: %s, serverName:%s version:%s", srv.address, srv.id, srv.name, srv.version)
-	time.Sleep(100 * time.Millisecond)
+	select {
+	case err := <-errCh:
+		// the server failed, the hooks of a started server still run
+		if atomic.LoadInt32(&srv.state) == stateReady {
+			if stopErr := srv.Stop(context.Background()); err == nil {
+				err = stopErr
+			}
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	err := srv.Stop(context.Background())
+	if startErr := <-errCh; startErr != nil {
+		return startErr
+	}
 	return err
 }
 
-func (srv *HttpServer) Start(ctx context.Context) error {
-	var (
-		addr string
-		err  error
-	)
+// Start listens on the address, runs the OnStart hooks and serves until the
+// server is stopped, it returns nil once stopped by Stop.
+func (srv *HttpServer) Start(ctx context.Context) (err error) {
 	defer func() {
-		srv.logger.Warnf("[HTTP] server closed on:%s, uuid: %s, serverName:%s version:%s err:%s", srv.address, srv.id, srv.name, srv.version, err.Error())
+		srv.logger.Warnf("[HTTP] server closed on:%s, uuid: %s, serverName:%s version:%s err:%v", srv.address, srv.id, srv.name, srv.version, err)
 	}()
-	addr, err = ExtractEndpoint(srv.address)
+
+	ln, err := net.Listen("tcp", srv.address)
 	if err != nil {
 		return err
 	}
+	addr, err := ExtractEndpoint(ln.Addr().String())
+	if err != nil {
+		ln.Close()
+		return err
+	}
 	srv.endpoint = &url.URL{
 		Scheme: "http",
 		Host:   addr,
 	}
 
+	for _, fn := range srv.onStart {
+		if err = fn(ctx); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	if !atomic.CompareAndSwapInt32(&srv.state, stateIdle, stateReady) {
+		// stopped while the hooks ran
+		ln.Close()
+		return nil
+	}
+	srv.logger.Warnf("[HTTP] server listening on:%s, uuid: %s, serverName:%s version:%s", ln.Addr(), srv.id, srv.name, srv.version)
+
 	if len(srv.certFile) > 0 && len(srv.keyFile) > 0 {
 		// tls server
-		err = srv.ListenAndServeTls(srv.address, srv.certFile, srv.keyFile)
+		err = srv.Server.ServeTLS(ln, srv.certFile, srv.keyFile)
 	} else {
-		err = srv.ListenAndServe(srv.address)
+		err = srv.Server.Serve(ln)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
 	}
 	return err
 }
 
+// Stop stops the server gracefully: the readiness probe fails, after the
+// shutdown delay the listener is closed and the active requests are drained
+// within the drain timeout or the deadline of ctx, then the OnStop hooks
+// run. The requests left are aborted and the drain error is returned.
 func (srv *HttpServer) Stop(ctx context.Context) error {
-	select {
-	case <-ctx.Done():
-		srv.Server.Shutdown(ctx)
+	state := atomic.SwapInt32(&srv.state, stateDraining)
+	if state == stateDraining || state == stateStopped {
+		atomic.StoreInt32(&srv.state, state)
+		return nil
 	}
-	return ctx.Err()
+
+	if state == stateReady && srv.shutdownDelay > 0 {
+		select {
+		case <-time.After(srv.shutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	drainCtx := ctx
+	if srv.drainTimeout > 0 {
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithTimeout(ctx, srv.drainTimeout)
+		defer cancel()
+	}
+	err := srv.Server.Shutdown(drainCtx)
+	if err != nil {
+		srv.logger.Errorf("[HTTP] server drain error: %v", err)
+		srv.Server.Close()
+	}
+
+	// the hooks of a server that never started are skipped
+	for i := len(srv.onStop) - 1; state == stateReady && i >= 0; i-- {
+		if hookErr := srv.onStop[i](ctx); hookErr != nil && err == nil {
+			err = hookErr
+		}
+	}
+	atomic.StoreInt32(&srv.state, stateStopped)
+	return err
+}
+
+// LivenessProbe implements eprobe.Eprobe, the server is alive until it stops.
+func (srv *HttpServer) LivenessProbe() eprobe.EprobeState {
+	if atomic.LoadInt32(&srv.state) == stateStopped {
+		return eprobe.EprobeStateFailure
+	}
+	return eprobe.EprobeStateOK
+}
+
+// ReadinessProbe implements eprobe.Eprobe, the server is ready once started
+// and until it starts stopping.
+func (srv *HttpServer) ReadinessProbe() eprobe.EprobeState {
+	if atomic.LoadInt32(&srv.state) == stateReady {
+		return eprobe.EprobeStateOK
+	}
+	return eprobe.EprobeStateFailure
+}
+
+// StartupProbe implements eprobe.Eprobe, the startup is complete once the
+// OnStart hooks ran.
+func (srv *HttpServer) StartupProbe() eprobe.EprobeState {
+	if atomic.LoadInt32(&srv.state) == stateIdle {
+		return eprobe.EprobeStateFailure
+	}
+	return eprobe.EprobeStateOK
 }
 
 func (srv *HttpServer) ID() string {
@@ -220,27 +448,6 @@ func (srv *HttpServer) ListenAndServeTls(address, certFile, keyFile string) erro
 	return srv.Server.ListenAndServeTLS(certFile, keyFile)
 }
 
-func (srv *HttpServer) filter() HandlerFunc {
-	return func(c *Context) {
-		var (
-			ctx       context.Context
-			ctxCancel context.CancelFunc
-		)
-		ctx = c.Request.Context()
-		if srv.timeOut > 0 {
-			ctx, ctxCancel = context.WithTimeout(ctx, srv.timeOut)
-		} else {
-			ctx, ctxCancel = context.WithCancel(ctx)
-		}
-		defer ctxCancel()
-		c.Request = c.Request.WithContext(ctx)
-		c.Next()
-		if ctx.Err() != nil {
-			c.Log.Errorf("http filter ctx error: %v", ctx.Err())
-		}
-	}
-}
-
 type Handler interface {
 	http.Handler
 	IRouters
@@ -250,12 +457,43 @@ type Handler interface {
 	WithLogger(logger Logger)
 }
 
+// RouterHandler is implemented by the Handler of New, a custom Handler may
+// implement it too. It configures the answers of the requests that match no
+// route:
+//
+//	srv.Handle().(httpx.RouterHandler).SetHandleMethodNotAllowed(true)
+type RouterHandler interface {
+	Handler
+
+	// NoRoute sets the handlers of the requests that match no route.
+	NoRoute(...HandlerFunc)
+	// NoMethod sets the handlers of the requests whose path is only
+	// registered with other methods.
+	NoMethod(...HandlerFunc)
+	// SPA serves a single page application to the requests without a route.
+	SPA(http.FileSystem)
+	// SetHandleMethodNotAllowed enables the 405 answers, disabled by default.
+	SetHandleMethodNotAllowed(bool)
+	// SetHandleOPTIONS enables the automatic OPTIONS answers, disabled by default.
+	SetHandleOPTIONS(bool)
+	// SetRedirectTrailingSlash enables the redirects to the path with or
+	// without the trailing slash, disabled by default.
+	SetRedirectTrailingSlash(bool)
+	// SetRedirectFixedPath enables the redirects to the cleaned,
+	// case-insensitive match of a path.
+	SetRedirectFixedPath(bool)
+	// SetRemoveExtraSlash enables serving the cleaned path of a request.
+	SetRemoveExtraSlash(bool)
+}
+
 type ehttpHandler struct {
 	*Router
 	Logger
 }
 
-func httpHandler() Handler {
+var _ RouterHandler = &ehttpHandler{}
+
+func httpHandler() *ehttpHandler {
 	return &ehttpHandler{
 		Router: NewRouter(),
 	}
@@ -280,6 +518,9 @@ func (h *ehttpHandler) handleHttpRequest(c *Context) {
 	if h.useRawPath && len(c.Request.URL.RawPath) > 0 {
 		rPath = c.Request.URL.RawPath
 	}
+	if h.RemoveExtraSlash {
+		rPath = cleanPath(rPath)
+	}
 
 	t := h.trees
 	for i := 0; i < len(t); i++ {
@@ -299,10 +540,91 @@ func (h *ehttpHandler) handleHttpRequest(c *Context) {
 			c.Writer.WriteHeaderNow()
 			return
 		}
+		if httpMethod != http.MethodConnect && rPath != "/" {
+			if value.tsr && h.RedirectTrailingSlash {
+				h.redirect(c, toggleTrailingSlash(rPath))
+				return
+			}
+			if h.RedirectFixedPath {
+				fixedPath, ok := root.findCaseInsensitivePath(cleanPath(rPath), h.RedirectTrailingSlash)
+				if ok && string(fixedPath) != rPath {
+					h.redirect(c, string(fixedPath))
+					return
+				}
+			}
+		}
 		break
 	}
 
-	c.ResponseWithCodeMessage(http.StatusNotFound, Default404Body)
+	if httpMethod == http.MethodOptions && h.HandleOPTIONS {
+		if allow := h.allowed(c, rPath, httpMethod); allow != "" {
+			c.Header(HeaderAllow, allow)
+			c.handlers = h.allOptions
+			c.Next()
+			c.Writer.WriteHeaderNow()
+			return
+		}
+	}
+
+	if h.HandleMethodNotAllowed {
+		if allow := h.allowed(c, rPath, httpMethod); allow != "" {
+			c.Header(HeaderAllow, allow)
+			c.handlers = h.allNoMethod
+			serveError(c, http.StatusMethodNotAllowed, Default405Body)
+			return
+		}
+	}
+
+	c.handlers = h.allNoRoute
+	serveError(c, http.StatusNotFound, Default404Body)
+}
+
+// redirect redirects a request to another path of the routes, keeping its
+// query. GET requests are answered 301, the others 308 so that the method
+// and the body are kept.
+func (h *ehttpHandler) redirect(c *Context, p string) {
+	// a path starting with two slashes would be a protocol relative URL
+	if strings.HasPrefix(p, "//") {
+		p = "/" + strings.TrimLeft(p, "/")
+	}
+
+	u := *c.Request.URL
+	u.Path, u.RawPath = p, ""
+	if h.useRawPath && len(c.Request.URL.RawPath) > 0 {
+		if unescaped, err := url.PathUnescape(p); err == nil {
+			u.Path, u.RawPath = unescaped, p
+		}
+	}
+
+	code := http.StatusMovedPermanently
+	if c.Request.Method != http.MethodGet {
+		code = http.StatusPermanentRedirect
+	}
+	http.Redirect(c.Writer, c.Request, u.String(), code)
+	c.Writer.WriteHeaderNow()
+}
+
+// toggleTrailingSlash adds the trailing slash of a path, or removes it.
+func toggleTrailingSlash(p string) string {
+	if n := len(p); n > 1 && p[n-1] == '/' {
+		return p[:n-1]
+	}
+	return p + "/"
+}
+
+// serveError runs the handlers of a request without a route, the default
+// message is written if they leave the response untouched.
+func serveError(c *Context, code int, defaultMessage []byte) {
+	c.Status(code)
+	c.Next()
+	if c.Writer.Written() {
+		return
+	}
+	if c.Writer.Status() == code {
+		c.ResponseWithCodeMessage(code, defaultMessage)
+		return
+	}
+	c.Writer.WriteHeaderNow()
 }
 
 func (h *ehttpHandler) WithLogger(logger Logger) {
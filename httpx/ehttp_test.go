@@ -2,12 +2,21 @@ package httpx
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"pkgx/eprobe"
 	"pkgx/httpx/render"
 	"syscall"
 	"testing"
+	"time"
 )
 
 func TestHttpServer_ListenAndServe(t *testing.T) {
@@ -44,3 +53,143 @@ func TestHttpServer_ListenAndServe(t *testing.T) {
 
 	<-ctx.Done()
 }
+
+func TestHttpServer_H2C(t *testing.T) {
+	srv := New(H2C(true), Http2MaxConcurrentStreams(10), NextProtos("http/1.1"), WithLogger(DefaultLogger))
+	srv.Handle().GET("/proto", func(c *Context) {
+		c.ResponseWithCodeMessage(http.StatusOK, []byte(c.Request.Proto))
+	})
+	assert.Equal(t, []string{"http/1.1"}, srv.Server.TLSConfig.NextProtos)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	go srv.Server.Serve(ln)
+	defer srv.Server.Close()
+
+	// prior knowledge
+	h2 := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	var protos []string
+	for _, client := range []*http.Client{h2, http.DefaultClient} {
+		resp, err := client.Get("http://" + ln.Addr().String() + "/proto")
+		if !assert.Nil(t, err) {
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		protos = append(protos, string(body))
+	}
+	assert.Equal(t, []string{"HTTP/2.0", "HTTP/1.1"}, protos)
+}
+
+// startServer runs a server on a free port and waits until it is ready.
+func startServer(t *testing.T, srv *HttpServer) (context.CancelFunc, <-chan error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.ReadinessProbe() != eprobe.EprobeStateOK {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("server not ready")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return cancel, done
+}
+
+func TestHttpServer_GracefulShutdown(t *testing.T) {
+	var events []string
+	hook := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			events = append(events, name)
+			return nil
+		}
+	}
+	started := make(chan struct{})
+	srv := New(Address("127.0.0.1:0"), TimeOut(0), Signals(), ShutdownDelay(20*time.Millisecond),
+		OnStart(hook("start1")), OnStart(hook("start2")), OnStop(hook("stop1")), OnStop(hook("stop2")))
+	srv.Handle().GET("/slow", func(c *Context) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		c.ResponseWithCodeMessage(http.StatusOK, []byte("done"))
+	})
+
+	assert.Equal(t, eprobe.EprobeStateFailure, srv.StartupProbe())
+	cancel, done := startServer(t, srv)
+	assert.Equal(t, eprobe.EprobeStateOK, srv.StartupProbe())
+	assert.Equal(t, eprobe.EprobeStateOK, srv.LivenessProbe())
+
+	type result struct {
+		body string
+		err  error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(srv.Endpoint()[0] + "/slow")
+		if err != nil {
+			resCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		resCh <- result{string(body), err}
+	}()
+	<-started
+	cancel()
+
+	// the readiness fails during the shutdown delay
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, eprobe.EprobeStateFailure, srv.ReadinessProbe())
+	assert.Equal(t, eprobe.EprobeStateOK, srv.LivenessProbe())
+
+	res := <-resCh
+	assert.Nil(t, res.err)
+	assert.Equal(t, "done", res.body)
+	assert.Nil(t, <-done)
+	assert.Equal(t, []string{"start1", "start2", "stop2", "stop1"}, events)
+	assert.Equal(t, eprobe.EprobeStateFailure, srv.LivenessProbe())
+}
+
+func TestHttpServer_ShutdownErrors(t *testing.T) {
+	// the requests outlasting the drain timeout are aborted
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	srv := New(Address("127.0.0.1:0"), TimeOut(0), Signals(), DrainTimeout(20*time.Millisecond))
+	srv.Handle().GET("/hang", func(c *Context) {
+		close(started)
+		<-release
+	})
+	cancel, done := startServer(t, srv)
+	go http.Get(srv.Endpoint()[0] + "/hang")
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+
+	// a failing hook stops the start
+	hookErr := errors.New("hook failed")
+	stopped := false
+	srv = New(Address("127.0.0.1:0"), Signals(),
+		OnStart(func(context.Context) error { return hookErr }),
+		OnStop(func(context.Context) error { stopped = true; return nil }))
+	assert.Equal(t, hookErr, srv.Run(context.Background()))
+	assert.False(t, stopped)
+
+	// the address is in use
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer ln.Close()
+	srv = New(Address(ln.Addr().String()), Signals())
+	assert.NotNil(t, srv.Run(context.Background()))
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"net/http"
+	"pkgx/httpx"
+	"strconv"
+	"time"
+)
+
+type options struct {
+	registry  *Registry
+	namespace string
+	buckets   []float64
+}
+
+type Option func(o *options)
+
+// WithRegistry sets the registry of the metrics, DefaultRegistry by default.
+func WithRegistry(r *Registry) Option {
+	return func(o *options) {
+		o.registry = r
+	}
+}
+
+// WithNamespace prefixes the names of the metrics, e.g. "api" for
+// api_http_requests_total.
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithBuckets sets the buckets of the latencies in seconds, DefaultBuckets
+// by default.
+func WithBuckets(buckets ...float64) Option {
+	return func(o *options) {
+		o.buckets = buckets
+	}
+}
+
+// HTTPMetrics are the metrics of the requests of a server, labelled by
+// method, route template and status:
+//
+//	http_requests_total               counter of the served requests
+//	http_request_duration_seconds     histogram of the latencies
+//	http_requests_in_flight           gauge of the requests being served, without status
+type HTTPMetrics struct {
+	requests *CounterVec
+	duration *HistogramVec
+	inFlight *GaugeVec
+}
+
+// NewHTTPMetrics registers the metrics of the requests, it panics if they
+// are already registered in the registry.
+func NewHTTPMetrics(opts ...Option) *HTTPMetrics {
+	o := &options{
+		registry: DefaultRegistry,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	prefix := ""
+	if o.namespace != "" {
+		prefix = o.namespace + "_"
+	}
+
+	return &HTTPMetrics{
+		requests: o.registry.NewCounter(prefix+"http_requests_total", "Total number of HTTP requests served.", "method", "route", "status"),
+		duration: o.registry.NewHistogram(prefix+"http_request_duration_seconds", "Latency of the HTTP requests in seconds.", o.buckets, "method", "route", "status"),
+		inFlight: o.registry.NewGauge(prefix+"http_requests_in_flight", "Number of HTTP requests being served.", "method", "route"),
+	}
+}
+
+// Middleware returns a middleware recording the requests. The route is the
+// template of GetFullPath, empty for the requests without a route, so that
+// the number of series stays bounded.
+func (m *HTTPMetrics) Middleware() httpx.HandlerFunc {
+	return func(c *httpx.Context) {
+		method := methodLabel(c.Request.Method)
+		route := c.GetFullPath()
+		inFlight := m.inFlight.With(method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		c.Next()
+		status := strconv.Itoa(c.Writer.Status())
+		m.requests.With(method, route, status).Inc()
+		m.duration.With(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler returns the handler of a metrics route, e.g.
+// router.GET("/metrics", metrics.Handler(metrics.DefaultRegistry)).
+func Handler(r *Registry) httpx.HandlerFunc {
+	return func(c *httpx.Context) {
+		c.Header(httpx.HeaderContentType, ContentType)
+		c.Status(http.StatusOK)
+		if _, err := r.WriteTo(c.Writer); err != nil {
+			c.Log.Errorf("metrics write error:%v", err)
+		}
+	}
+}
+
+// methodLabel returns the method of a request, the unknown methods are
+// counted together.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// CacheStats are the statistics of a cache, e.g. cache.CacheStat.
+type CacheStats interface {
+	Hit() uint64
+	Miss() uint64
+}
+
+// RegisterCache exposes the hits and the misses of a cache as
+// cache_hits_total and cache_misses_total, labelled by cache name.
+func (r *Registry) RegisterCache(name string, stat CacheStats) {
+	r.CounterFunc("cache_hits_total", "Total number of cache hits.", Labels{"cache": name}, func() float64 {
+		return float64(stat.Hit())
+	})
+	r.CounterFunc("cache_misses_total", "Total number of cache misses.", Labels{"cache": name}, func() float64 {
+		return float64(stat.Miss())
+	})
+}
+
+// Queue is a queue of tasks, e.g. a timingwheel.TimingWheel.
+type Queue interface {
+	Len() int
+}
+
+// RegisterQueue exposes the number of pending tasks of a queue as
+// queue_depth, labelled by queue name.
+func (r *Registry) RegisterQueue(name string, q Queue) {
+	r.GaugeFunc("queue_depth", "Number of pending tasks of the queue.", Labels{"queue": name}, func() float64 {
+		return float64(q.Len())
+	})
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pkgx/cache"
+	"pkgx/collection/timingwheel"
+	"pkgx/httpx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ CacheStats = (*cache.CacheStat)(nil)
+	_ Queue      = (*timingwheel.TimingWheel[string, int])(nil)
+)
+
+type queue int
+
+func (q queue) Len() int {
+	return int(q)
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	r := NewRegistry()
+	m := NewHTTPMetrics(WithRegistry(r), WithNamespace("api"), WithBuckets(0.1, 1))
+	stat := &cache.CacheStat{}
+	stat.IncrementHit()
+	stat.IncrementHit()
+	stat.IncrementMiss()
+	r.RegisterCache("users", stat)
+	r.RegisterQueue("expire", queue(3))
+
+	h := httpx.New(httpx.TimeOut(0)).Handle().(httpx.RouterHandler)
+	h.SetHandleMethodNotAllowed(true)
+	h.Use(m.Middleware())
+	h.GET("/users/:id", func(c *httpx.Context) {
+		c.ResponseWithCodeMessage(http.StatusOK, []byte("user"))
+	})
+	h.GET("/metrics", Handler(r))
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/users/1"},
+		{http.MethodGet, "/users/2"},
+		{http.MethodPost, "/users/2"},
+		{"PURGE", "/missing"},
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-type"))
+	body := w.Body.String()
+	for _, line := range []string{
+		`api_http_requests_total{method="GET",route="/users/:id",status="200"} 2`,
+		`api_http_requests_total{method="POST",route="",status="405"} 1`,
+		`api_http_requests_total{method="OTHER",route="",status="404"} 1`,
+		`api_http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="200",le="+Inf"} 2`,
+		`api_http_request_duration_seconds_count{method="OTHER",route="",status="404"} 1`,
+		// the scrape is in flight
+		`api_http_requests_in_flight{method="GET",route="/metrics"} 1`,
+		`api_http_requests_in_flight{method="GET",route="/users/:id"} 0`,
+		`cache_hits_total{cache="users"} 2`,
+		`cache_misses_total{cache="users"} 1`,
+		`queue_depth{queue="expire"} 3`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	assert.Equal(t, 3, strings.Count(body, "api_http_request_duration_seconds_bucket{method=\"GET\",route=\"/users/:id\""))
+}
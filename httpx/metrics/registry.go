@@ -0,0 +1,497 @@
+// Package metrics records counters, gauges and histograms and exposes them
+// in the Prometheus text format, version 0.0.4, without the client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the content type of the text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// DefaultRegistry is the registry of the metrics by default.
+var DefaultRegistry = NewRegistry()
+
+// Labels are the names and the values of the labels of a series.
+type Labels map[string]string
+
+// collector is a metric family.
+type collector interface {
+	describe() (name, help, typ string)
+	// collect writes the samples of the series.
+	collect(w *bufio.Writer)
+}
+
+// Registry holds the metric families, it implements http.Handler for the
+// scrapes, e.g. on the eprobe server.
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []collector
+	byName     map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: make(map[string]collector),
+	}
+}
+
+// register adds a collector, it panics if the name is taken or invalid.
+func (r *Registry) register(c collector) {
+	name, _, _ := c.describe()
+	if !validName(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byName[name]; ok {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+	}
+	r.byName[name] = c
+	r.collectors = append(r.collectors, c)
+}
+
+// NewCounter registers a counter with the label names, it panics if the
+// name is taken.
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *CounterVec {
+	v := &CounterVec{vec: newVec(name, help, typeCounter, labelNames)}
+	r.register(v)
+	return v
+}
+
+// NewGauge registers a gauge with the label names, it panics if the name
+// is taken.
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *GaugeVec {
+	v := &GaugeVec{vec: newVec(name, help, typeGauge, labelNames)}
+	r.register(v)
+	return v
+}
+
+// NewHistogram registers a histogram with the upper bounds of its buckets
+// and the label names, DefaultBuckets if buckets is empty. It panics if the
+// name is taken.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	if n := len(buckets); math.IsInf(buckets[n-1], 1) {
+		buckets = buckets[:n-1]
+	}
+	v := &HistogramVec{vec: newVec(name, help, typeHistogram, labelNames), buckets: buckets}
+	r.register(v)
+	return v
+}
+
+// CounterFunc registers a series of a counter read from fn at each scrape,
+// e.g. a total kept by another package. The series of a name share the
+// label names.
+func (r *Registry) CounterFunc(name, help string, labels Labels, fn func() float64) {
+	r.registerFunc(name, help, typeCounter, labels, fn)
+}
+
+// GaugeFunc registers a series of a gauge read from fn at each scrape. The
+// series of a name share the label names.
+func (r *Registry) GaugeFunc(name, help string, labels Labels, fn func() float64) {
+	r.registerFunc(name, help, typeGauge, labels, fn)
+}
+
+func (r *Registry) registerFunc(name, help, typ string, labels Labels, fn func() float64) {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	values := make([]string, len(names))
+	for i, k := range names {
+		values[i] = labels[k]
+	}
+
+	r.mu.Lock()
+	c, ok := r.byName[name]
+	if !ok {
+		if !validName(name) {
+			r.mu.Unlock()
+			panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+		}
+		c = newFuncVec(name, help, typ, names)
+		r.byName[name] = c
+		r.collectors = append(r.collectors, c)
+	}
+	r.mu.Unlock()
+
+	f, ok := c.(*funcVec)
+	if !ok || f.typ != typ || strings.Join(f.labelNames, ",") != strings.Join(names, ",") {
+		panic(fmt.Sprintf("metrics: %q is registered with another type or labels", name))
+	}
+	f.set(values, fn)
+}
+
+// WriteTo writes the metrics in the text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		name, help, typ := c.describe()
+		if help != "" {
+			bw.WriteString("# HELP " + name + " " + helpReplacer.Replace(help) + "\n")
+		}
+		bw.WriteString("# TYPE " + name + " " + typ + "\n")
+		c.collect(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// vec holds the series of a metric by label values.
+type vec struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+
+	mu     sync.RWMutex
+	series map[string]any
+}
+
+func newVec(name, help, typ string, labelNames []string) vec {
+	for _, l := range labelNames {
+		if !validLabelName(l) {
+			panic(fmt.Sprintf("metrics: invalid label name %q of %q", l, name))
+		}
+	}
+	return vec{name: name, help: help, typ: typ, labelNames: labelNames, series: make(map[string]any)}
+}
+
+func (v *vec) describe() (string, string, string) {
+	return v.name, v.help, v.typ
+}
+
+// get returns the series of the label values, created by newSeries.
+func (v *vec) get(values []string, newSeries func() any) any {
+	if len(values) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %d label values for the %d labels of %q", len(values), len(v.labelNames), v.name))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok = v.series[key]; !ok {
+		s = newSeries()
+		v.series[key] = s
+	}
+	return s
+}
+
+// each calls fn with the labels of the series sorted by label values.
+func (v *vec) each(fn func(labels string, s any)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	series := make([]any, len(keys))
+	sort.Strings(keys)
+	for i, k := range keys {
+		series[i] = v.series[k]
+	}
+	v.mu.RUnlock()
+
+	for i, k := range keys {
+		var values []string
+		if len(v.labelNames) > 0 {
+			values = strings.Split(k, "\xff")
+		}
+		fn(formatLabels(v.labelNames, values), series[i])
+	}
+}
+
+// value is a float updated atomically.
+type value struct {
+	bits uint64
+}
+
+func (v *value) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		if atomic.CompareAndSwapUint64(&v.bits, old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (v *value) set(f float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(f))
+}
+
+func (v *value) get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+// CounterVec is a counter with labels.
+type CounterVec struct {
+	vec
+}
+
+// Counter is a series of a counter, it only increases.
+type Counter struct {
+	v value
+}
+
+// With returns the series of the label values in the order of the label
+// names, it panics if their number differs.
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.get(values, func() any { return &Counter{} }).(*Counter)
+}
+
+func (c *CounterVec) collect(w *bufio.Writer) {
+	c.each(func(labels string, s any) {
+		writeSample(w, c.name, labels, s.(*Counter).Value())
+	})
+}
+
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+// Add adds a delta, a negative delta is ignored.
+func (c *Counter) Add(delta float64) {
+	if delta > 0 {
+		c.v.add(delta)
+	}
+}
+
+func (c *Counter) Value() float64 {
+	return c.v.get()
+}
+
+// GaugeVec is a gauge with labels.
+type GaugeVec struct {
+	vec
+}
+
+// Gauge is a series of a gauge.
+type Gauge struct {
+	v value
+}
+
+// With returns the series of the label values in the order of the label
+// names, it panics if their number differs.
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.get(values, func() any { return &Gauge{} }).(*Gauge)
+}
+
+func (g *GaugeVec) collect(w *bufio.Writer) {
+	g.each(func(labels string, s any) {
+		writeSample(w, g.name, labels, s.(*Gauge).Value())
+	})
+}
+
+func (g *Gauge) Set(f float64) {
+	g.v.set(f)
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.v.add(delta)
+}
+
+func (g *Gauge) Inc() {
+	g.v.add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.v.add(-1)
+}
+
+func (g *Gauge) Value() float64 {
+	return g.v.get()
+}
+
+// DefaultBuckets are the buckets of the latencies in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HistogramVec is a histogram with labels.
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+// Histogram is a series of a histogram, it counts the observations by
+// bucket.
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// With returns the series of the label values in the order of the label
+// names, it panics if their number differs.
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.get(values, func() any {
+		return &Histogram{buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+	}).(*Histogram)
+}
+
+func (h *HistogramVec) collect(w *bufio.Writer) {
+	h.each(func(labels string, s any) {
+		hist := s.(*Histogram)
+		hist.mu.Lock()
+		counts := append([]uint64(nil), hist.counts...)
+		count, sum := hist.count, hist.sum
+		hist.mu.Unlock()
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += counts[i]
+			writeSample(w, h.name+"_bucket", withLabel(labels, "le", formatFloat(bound)), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", withLabel(labels, "le", "+Inf"), float64(count))
+		writeSample(w, h.name+"_sum", labels, sum)
+		writeSample(w, h.name+"_count", labels, float64(count))
+	})
+}
+
+func (h *Histogram) Observe(f float64) {
+	i := sort.SearchFloat64s(h.buckets, f)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += f
+}
+
+// funcVec is a metric whose series are read from functions.
+type funcVec struct {
+	vec
+}
+
+func newFuncVec(name, help, typ string, labelNames []string) *funcVec {
+	return &funcVec{vec: newVec(name, help, typ, labelNames)}
+}
+
+func (f *funcVec) set(values []string, fn func() float64) {
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.series[key] = fn
+}
+
+func (f *funcVec) collect(w *bufio.Writer) {
+	f.each(func(labels string, s any) {
+		writeSample(w, f.name, labels, s.(func() float64)())
+	})
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func writeSample(w *bufio.Writer, name, labels string, f float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(f))
+	w.WriteByte('\n')
+}
+
+// formatLabels returns the labels of a series, name="value" separated by commas.
+func formatLabels(names, values []string) string {
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name + `="` + labelReplacer.Replace(values[i]) + `"`)
+	}
+	return b.String()
+}
+
+func withLabel(labels, name, value string) string {
+	l := name + `="` + value + `"`
+	if labels == "" {
+		return l
+	}
+	return labels + "," + l
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// validName reports whether a metric name matches [a-zA-Z_:][a-zA-Z0-9_:]*.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// validLabelName reports whether a label name matches [a-zA-Z_][a-zA-Z0-9_]*
+// and is not reserved.
+func validLabelName(name string) bool {
+	return validName(name) && !strings.Contains(name, ":") && !strings.HasPrefix(name, "__") && name != "le"
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	jobs := r.NewCounter("jobs_total", "Total jobs.\nWith \\ escapes.", "queue", "result")
+	jobs.With("a", "ok").Add(2)
+	jobs.With("a", "ok").Inc()
+	jobs.With("a", "ok").Add(-1)
+	jobs.With(`q"1`, "fail\n").Inc()
+	temp := r.NewGauge("temperature", "")
+	temp.With().Set(21.5)
+	temp.With().Dec()
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1, math.Inf(1)}, "op")
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		latency.With("get").Observe(v)
+	}
+	r.GaugeFunc("up", "Up.", nil, func() float64 { return 1 })
+	r.CounterFunc("reads_total", "Reads.", Labels{"disk": "b"}, func() float64 { return 2 })
+	r.CounterFunc("reads_total", "Reads.", Labels{"disk": "a"}, func() float64 { return math.Inf(1) })
+
+	var b strings.Builder
+	n, err := r.WriteTo(&b)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(b.Len()), n)
+	assert.Equal(t, `# HELP jobs_total Total jobs.\nWith \\ escapes.
+# TYPE jobs_total counter
+jobs_total{queue="a",result="ok"} 3
+jobs_total{queue="q\"1",result="fail\n"} 1
+# TYPE temperature gauge
+temperature 20.5
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="get",le="0.1"} 2
+latency_seconds_bucket{op="get",le="1"} 3
+latency_seconds_bucket{op="get",le="+Inf"} 4
+latency_seconds_sum{op="get"} 3.65
+latency_seconds_count{op="get"} 4
+# HELP up Up.
+# TYPE up gauge
+up 1
+# HELP reads_total Reads.
+# TYPE reads_total counter
+reads_total{disk="a"} +Inf
+reads_total{disk="b"} 2
+`, b.String())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, b.String(), w.Body.String())
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("c_total", "", "a")
+	assert.Panics(t, func() { r.NewGauge("c_total", "") })
+	assert.Panics(t, func() { r.NewGauge("bad-name", "") })
+	assert.Panics(t, func() { r.NewGauge("g", "", "__reserved") })
+	assert.Panics(t, func() { r.NewHistogram("h", "", nil, "le") })
+	assert.Panics(t, func() { c.With("a", "b") })
+	assert.Panics(t, func() { r.GaugeFunc("c_total", "", Labels{"a": "1"}, func() float64 { return 0 }) })
+	r.GaugeFunc("f", "", Labels{"a": "1"}, func() float64 { return 0 })
+	assert.Panics(t, func() { r.GaugeFunc("f", "", Labels{"b": "1"}, func() float64 { return 0 }) })
+	assert.Panics(t, func() { r.CounterFunc("f", "", Labels{"a": "2"}, func() float64 { return 0 }) })
+}
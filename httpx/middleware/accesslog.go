@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"pkgx/httpx"
+	"pkgx/httpx/trace"
+	"time"
+)
+
+// The fields of the access log records.
+const (
+	FieldMethod    = "method"
+	FieldRoute     = "route"
+	FieldPath      = "path"
+	FieldQuery     = "query"
+	FieldProto     = "proto"
+	FieldHost      = "host"
+	FieldStatus    = "status"
+	FieldSize      = "size"
+	FieldLatency   = "latency_ms"
+	FieldClientIP  = "client_ip"
+	FieldUserAgent = "user_agent"
+	FieldReferer   = "referer"
+	FieldRequestID = "request_id"
+)
+
+// DefaultAccessLogFields are the fields of the records by default.
+var DefaultAccessLogFields = []string{
+	FieldMethod, FieldRoute, FieldPath, FieldStatus, FieldSize, FieldLatency, FieldClientIP, FieldUserAgent, FieldRequestID,
+}
+
+// AccessLogConfig configures AccessLog.
+type AccessLogConfig struct {
+	// Logger writes the records, the logger of the Context by default.
+	Logger httpx.Logger
+	// Fields are the fields of the records in order, DefaultAccessLogFields
+	// by default. Another name is the request header of that name.
+	Fields []string
+	// SkipPaths are the request paths not logged, e.g. "/healthz".
+	SkipPaths []string
+	// Skip reports whether a request is not logged, it is called once the
+	// request is served.
+	Skip func(c *httpx.Context) bool
+	// SampleRate is the fraction of the requests answered below 500 that
+	// are logged, e.g. 0.1, all of them by default. The server errors are
+	// always logged.
+	SampleRate float64
+}
+
+// AccessLog returns a middleware writing one record per request once it is
+// served. The record is a JSON object of the configured fields, written
+// with Info, Warn for the 4xx answers and Error for the 5xx ones.
+func AccessLog(config AccessLogConfig) httpx.HandlerFunc {
+	fields := config.Fields
+	if len(fields) == 0 {
+		fields = DefaultAccessLogFields
+	}
+	skipPaths := make(map[string]bool, len(config.SkipPaths))
+	for _, p := range config.SkipPaths {
+		skipPaths[p] = true
+	}
+
+	return func(c *httpx.Context) {
+		if skipPaths[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		// the handlers may change the request
+		req := c.Request
+		c.Next()
+		latency := time.Since(start)
+
+		status := c.Writer.Status()
+		if config.Skip != nil && config.Skip(c) {
+			return
+		}
+		if status < http.StatusInternalServerError && config.SampleRate > 0 && config.SampleRate < 1 && rand.Float64() >= config.SampleRate {
+			return
+		}
+
+		logger := config.Logger
+		if logger == nil {
+			logger = c.Log
+		}
+		record := accessRecord(c, req, fields, status, latency)
+		switch {
+		case status >= http.StatusInternalServerError:
+			logger.Errorf("%s", record)
+		case status >= http.StatusBadRequest:
+			logger.Warnf("%s", record)
+		default:
+			logger.Infof("%s", record)
+		}
+	}
+}
+
+// accessRecord encodes the fields of a request as a JSON object.
+func accessRecord(c *httpx.Context, req *http.Request, fields []string, status int, latency time.Duration) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range fields {
+		var value any
+		switch field {
+		case FieldMethod:
+			value = req.Method
+		case FieldRoute:
+			value = c.GetFullPath()
+		case FieldPath:
+			value = req.URL.Path
+		case FieldQuery:
+			value = req.URL.RawQuery
+		case FieldProto:
+			value = req.Proto
+		case FieldHost:
+			value = req.Host
+		case FieldStatus:
+			value = status
+		case FieldSize:
+			value = 0
+			if size := c.Writer.Size(); size > 0 {
+				value = size
+			}
+		case FieldLatency:
+			value = float64(latency.Microseconds()) / 1000
+		case FieldClientIP:
+			value = c.ClientIP()
+		case FieldUserAgent:
+			value = req.UserAgent()
+		case FieldReferer:
+			value = req.Referer()
+		case FieldRequestID:
+			value = requestID(c, req)
+		default:
+			value = req.Header.Get(field)
+		}
+
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field)
+		buf.Write(key)
+		buf.WriteByte(':')
+		b, _ := json.Marshal(value)
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// requestID returns the request ID of RequestID, or the one of the answer
+// or the request.
+func requestID(c *httpx.Context, req *http.Request) string {
+	if id, ok := c.Get(RequestIDKey); ok {
+		if s, ok := id.(string); ok {
+			return s
+		}
+	}
+	if id := c.Writer.Header().Get(trace.HeaderRequestID); id != "" {
+		return id
+	}
+	return req.Header.Get(trace.HeaderRequestID)
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"pkgx/httpx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordLogger keeps the records by level.
+type recordLogger struct {
+	httpx.Logger
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+func (l *recordLogger) add(level, format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.records == nil {
+		l.records = make(map[string][]string)
+	}
+	l.records[level] = append(l.records[level], fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Infof(format string, args ...any)  { l.add("info", format, args...) }
+func (l *recordLogger) Warnf(format string, args ...any)  { l.add("warn", format, args...) }
+func (l *recordLogger) Errorf(format string, args ...any) { l.add("error", format, args...) }
+
+func TestAccessLog(t *testing.T) {
+	logger := &recordLogger{}
+	h := httpx.New(httpx.TimeOut(0)).Handle()
+	h.Use(AccessLog(AccessLogConfig{
+		Logger:    logger,
+		SkipPaths: []string{"/healthz"},
+		Skip: func(c *httpx.Context) bool {
+			return c.GetParam("id") == "skip"
+		},
+	}))
+	h.GET("/healthz", func(c *httpx.Context) {})
+	h.GET("/users/:id", func(c *httpx.Context) {
+		c.Header("X-Request-ID", "req-1")
+		c.ResponseWithCodeMessage(http.StatusOK, []byte("user "+c.GetParam("id")))
+	})
+	h.GET("/fail", func(c *httpx.Context) {
+		c.ResponseWithCode(http.StatusBadGateway)
+	})
+
+	serve := func(path string) {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("User-Agent", "test/1.0")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	for _, path := range []string{"/users/42", "/healthz", "/users/skip", "/missing", "/fail"} {
+		serve(path)
+	}
+
+	if !assert.Len(t, logger.records["info"], 1) {
+		return
+	}
+	var record map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(logger.records["info"][0]), &record))
+	latency := record["latency_ms"]
+	assert.IsType(t, float64(0), latency)
+	delete(record, "latency_ms")
+	assert.Equal(t, map[string]any{
+		"method":     "GET",
+		"route":      "/users/:id",
+		"path":       "/users/42",
+		"status":     float64(200),
+		"size":       float64(7),
+		"client_ip":  "10.0.0.1",
+		"user_agent": "test/1.0",
+		"request_id": "req-1",
+	}, record)
+
+	// the default 404 body is written after the handlers
+	assert.Equal(t, []string{`{"method":"GET","route":"","path":"/missing","status":404,"size":0,"latency_ms":` + jsonField(t, logger.records["warn"][0], "latency_ms") + `,"client_ip":"10.0.0.1","user_agent":"test/1.0","request_id":""}`}, logger.records["warn"])
+	assert.Len(t, logger.records["error"], 1)
+}
+
+func TestAccessLog_Fields(t *testing.T) {
+	logger := &recordLogger{}
+	h := httpx.New(httpx.TimeOut(0)).Handle()
+	h.Use(AccessLog(AccessLogConfig{
+		Logger:     logger,
+		Fields:     []string{FieldStatus, FieldQuery, "X-Tenant"},
+		SampleRate: 1e-9,
+	}))
+	h.GET("/ok", func(c *httpx.Context) {})
+	h.GET("/fail", func(c *httpx.Context) {
+		c.ResponseWithCode(http.StatusInternalServerError)
+	})
+
+	for _, path := range []string{"/ok?a=1", "/ok", "/fail?b=2"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("X-Tenant", "t1")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	// the server errors are not sampled
+	assert.Empty(t, logger.records["info"])
+	assert.Equal(t, []string{`{"status":500,"query":"b=2","X-Tenant":"t1"}`}, logger.records["error"])
+}
+
+func jsonField(t *testing.T, record, field string) string {
+	var fields map[string]json.RawMessage
+	assert.Nil(t, json.Unmarshal([]byte(record), &fields))
+	return string(fields[field])
+}
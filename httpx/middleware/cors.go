@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"net/http"
+	"pkgx/httpx"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig is the Cross-Origin Resource Sharing policy of CORS.
+type CORSConfig struct {
+	// AllowOrigins are the allowed origins, e.g. "https://example.com". "*"
+	// allows all the origins and "https://*.example.com" the subdomains, a
+	// pattern has one "*" at most, AllowOriginRegexps matches the others.
+	AllowOrigins []string
+	// AllowOriginRegexps are the regular expressions of the allowed origins,
+	// e.g. `^https://[a-z]+\.example\.com$`.
+	AllowOriginRegexps []string
+	// AllowOriginFunc reports whether an origin is allowed, it is called
+	// when the origin matches none of the above.
+	AllowOriginFunc func(origin string) bool
+	// AllowMethods are the methods of the preflight answers, the methods of
+	// the route given by the router by default.
+	AllowMethods []string
+	// AllowHeaders are the request headers of the preflight answers, the
+	// headers the preflight request asks for by default.
+	AllowHeaders []string
+	// ExposeHeaders are the response headers the browser exposes to scripts.
+	ExposeHeaders []string
+	// AllowCredentials allows the cookies and the authorization headers, it
+	// cannot be used with the "*" origin, the origins are listed instead.
+	// The origin is answered instead of "*".
+	AllowCredentials bool
+	// MaxAge is how long the browser caches a preflight answer.
+	MaxAge time.Duration
+	// OptionsPassthrough passes the preflight requests to the next handlers,
+	// e.g. OPTIONS routes, instead of answering them 204.
+	OptionsPassthrough bool
+}
+
+// DefaultCORSConfig allows all the origins without credentials.
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowOrigins: []string{"*"},
+		MaxAge:       12 * time.Hour,
+	}
+}
+
+var defaultCORSMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+type cors struct {
+	allowAll         bool
+	origins          map[string]bool
+	wildcards        [][2]string
+	regexps          []*regexp.Regexp
+	originFunc       func(origin string) bool
+	allowMethods     string
+	allowHeaders     string
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
+	passthrough      bool
+}
+
+// CORS returns a middleware applying a CORS policy. The preflight requests
+// are answered 204, the requests of the origins not allowed are passed on
+// without the CORS headers and their preflight requests are answered 403.
+// It panics if a regular expression or an origin pattern of the config is
+// invalid, or if the credentials are allowed with all the origins.
+//
+// The automatic OPTIONS answers of the router, see SetHandleOPTIONS, only
+// run the handlers of Use, CORS is registered there to answer the preflight
+// requests of all the routes. The methods of a preflight answer are then
+// those of its route.
+func CORS(config CORSConfig) httpx.HandlerFunc {
+	p := &cors{
+		origins:          make(map[string]bool),
+		originFunc:       config.AllowOriginFunc,
+		allowMethods:     strings.Join(config.AllowMethods, ", "),
+		allowHeaders:     strings.Join(config.AllowHeaders, ", "),
+		exposeHeaders:    strings.Join(config.ExposeHeaders, ", "),
+		allowCredentials: config.AllowCredentials,
+		passthrough:      config.OptionsPassthrough,
+	}
+	for _, origin := range config.AllowOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			p.allowAll = true
+		case strings.Count(origin, "*") > 1:
+			panic("middleware: CORS origin " + origin + " has more than one \"*\"")
+		case strings.Contains(origin, "*"):
+			i := strings.Index(origin, "*")
+			p.wildcards = append(p.wildcards, [2]string{origin[:i], origin[i+1:]})
+		default:
+			p.origins[origin] = true
+		}
+	}
+	for _, expr := range config.AllowOriginRegexps {
+		p.regexps = append(p.regexps, regexp.MustCompile(expr))
+	}
+	if p.allowAll && p.allowCredentials {
+		panic("middleware: CORS with AllowCredentials cannot allow all the origins with \"*\"")
+	}
+	if config.MaxAge > 0 {
+		p.maxAge = strconv.FormatInt(int64(config.MaxAge/time.Second), 10)
+	}
+
+	return func(c *httpx.Context) {
+		origin := c.Request.Header.Get(httpx.HeaderOrigin)
+		preflight := c.Request.Method == http.MethodOptions && c.Request.Header.Get(httpx.HeaderAccessControlRequestMethod) != ""
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		if !p.allowAll {
+			header.Add(httpx.HeaderVary, httpx.HeaderOrigin)
+		}
+		if !p.allowed(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if p.allowAll {
+			header.Set(httpx.HeaderAccessControlAllowOrigin, "*")
+		} else {
+			header.Set(httpx.HeaderAccessControlAllowOrigin, origin)
+		}
+		if p.allowCredentials {
+			header.Set(httpx.HeaderAccessControlAllowCredentials, "true")
+		}
+		if !preflight {
+			if p.exposeHeaders != "" {
+				header.Set(httpx.HeaderAccessControlExposeHeaders, p.exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		header.Add(httpx.HeaderVary, httpx.HeaderAccessControlRequestMethod)
+		header.Add(httpx.HeaderVary, httpx.HeaderAccessControlRequestHeaders)
+		header.Set(httpx.HeaderAccessControlAllowMethods, p.methods(header))
+		if allowHeaders := p.headers(c.Request.Header); allowHeaders != "" {
+			header.Set(httpx.HeaderAccessControlAllowHeaders, allowHeaders)
+		}
+		if p.maxAge != "" {
+			header.Set(httpx.HeaderAccessControlMaxAge, p.maxAge)
+		}
+		if p.passthrough {
+			c.Next()
+			return
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// allowed reports whether an origin is allowed.
+func (p *cors) allowed(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if p.origins[lower] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+			return true
+		}
+	}
+	for _, re := range p.regexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return p.originFunc != nil && p.originFunc(origin)
+}
+
+// methods returns the allowed methods of a preflight request, the Allow
+// header of the automatic OPTIONS answers is used by default.
+func (p *cors) methods(header http.Header) string {
+	if p.allowMethods != "" {
+		return p.allowMethods
+	}
+	if allow := header.Get(httpx.HeaderAllow); allow != "" {
+		return allow
+	}
+	return strings.Join(defaultCORSMethods, ", ")
+}
+
+// headers returns the allowed headers of a preflight request.
+func (p *cors) headers(request http.Header) string {
+	if p.allowHeaders != "" {
+		return p.allowHeaders
+	}
+	return request.Get(httpx.HeaderAccessControlRequestHeaders)
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pkgx/httpx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	h := httpx.New(httpx.TimeOut(0)).Handle().(httpx.RouterHandler)
+	h.SetHandleOPTIONS(true)
+	h.Use(CORS(CORSConfig{
+		AllowOrigins:       []string{"https://example.com", "https://*.example.org"},
+		AllowOriginRegexps: []string{`^http://localhost:\d+$`},
+		AllowOriginFunc:    func(origin string) bool { return origin == "null" },
+		ExposeHeaders:      []string{"X-Total"},
+		AllowCredentials:   true,
+		MaxAge:             time.Hour,
+	}))
+	h.GET("/users", func(c *httpx.Context) {
+		c.ResponseWithCodeMessage(http.StatusOK, []byte("users"))
+	})
+	h.PUT("/users", func(c *httpx.Context) {})
+
+	serve := func(method, origin string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/users", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// actual requests
+	for _, origin := range []string{"https://example.com", "https://API.example.org", "http://localhost:8080", "null"} {
+		w := serve(http.MethodGet, origin, nil)
+		assert.Equal(t, http.StatusOK, w.Code, origin)
+		assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "X-Total", w.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	}
+	for _, origin := range []string{"", "https://evil.com", "https://example.org", "http://localhost:80x"} {
+		w := serve(http.MethodGet, origin, nil)
+		assert.Equal(t, http.StatusOK, w.Code, origin)
+		assert.Equal(t, "users", w.Body.String())
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+
+	// preflight requests use the methods of the route
+	w := serve(http.MethodOptions, "https://example.com", map[string]string{
+		"Access-Control-Request-Method":  "PUT",
+		"Access-Control-Request-Headers": "X-Token, Content-Type",
+	})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, OPTIONS, PUT", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "X-Token, Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "3600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "Origin, Access-Control-Request-Method, Access-Control-Request-Headers", strings.Join(w.Header().Values("Vary"), ", "))
+	assert.Empty(t, w.Header().Get("Access-Control-Expose-Headers"))
+
+	w = serve(http.MethodOptions, "https://evil.com", map[string]string{"Access-Control-Request-Method": "PUT"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// a plain OPTIONS request is answered by the router
+	w = serve(http.MethodOptions, "", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, OPTIONS, PUT", w.Header().Get("Allow"))
+}
+
+func TestCORS_Options(t *testing.T) {
+	h := httpx.New(httpx.TimeOut(0)).Handle().(httpx.RouterHandler)
+	h.SetHandleOPTIONS(true)
+	h.Group("/default", CORS(DefaultCORSConfig())).GET("/", func(c *httpx.Context) {})
+	h.OPTIONS("/passthrough", CORS(CORSConfig{
+		AllowOrigins:       []string{"*"},
+		AllowMethods:       []string{"GET", "POST"},
+		AllowHeaders:       []string{"Content-Type"},
+		OptionsPassthrough: true,
+	}), func(c *httpx.Context) {
+		c.ResponseWithCode(http.StatusOK)
+	})
+
+	// the credentials need the origins to be listed
+	assert.Panics(t, func() {
+		CORS(CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true})
+	})
+	// an origin pattern has one wildcard at most
+	assert.Panics(t, func() {
+		CORS(CORSConfig{AllowOrigins: []string{"https://*.*.example.com"}})
+	})
+
+	preflight := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodOptions, path, nil)
+		r.Header.Set("Origin", "https://any.com")
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		r.Header.Set("Access-Control-Request-Headers", "X-Token")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := preflight("/passthrough")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Empty(t, w.Header().Get("Access-Control-Max-Age"))
+
+	// the automatic OPTIONS answers do not run the group handlers
+	w = preflight("/default/")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	r := httptest.NewRequest(http.MethodGet, "/default/", nil)
+	r.Header.Set("Origin", "https://any.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Vary"))
+}
@@ -1,16 +1,12 @@
 package middleware
 
 import (
-	"fmt"
 	"pkgx/httpx"
-	"time"
 )
 
+// HandleLog returns AccessLog with the default config.
+//
+// Deprecated: use AccessLog.
 func HandleLog() httpx.HandlerFunc {
-	return func(c *httpx.Context) {
-		start := time.Now()
-		c.Next()
-		duration := time.Now().Sub(start)
-		fmt.Println(duration)
-	}
+	return AccessLog(AccessLogConfig{})
 }
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"pkgx/httpx"
+	"pkgx/httpx/trace"
+)
+
+// The keys of the Context set by RequestID.
+const (
+	RequestIDKey   = "request_id"
+	SpanContextKey = "span_context"
+)
+
+// RequestID returns a middleware continuing the X-Request-ID and the W3C
+// traceparent of a request, or starting new ones. The trace.SpanContext is
+// set in Keys and in the request context for the client calls, see
+// client.TraceCall, and its headers are echoed in the response.
+func RequestID() httpx.HandlerFunc {
+	return func(c *httpx.Context) {
+		sc := trace.Extract(c.Request.Header)
+		c.Set(RequestIDKey, sc.RequestID)
+		c.Set(SpanContextKey, sc)
+		c.Request = c.Request.WithContext(trace.NewContext(c.Request.Context(), sc))
+		c.Header(trace.HeaderRequestID, sc.RequestID)
+		c.Header(trace.HeaderTraceparent, sc.Traceparent())
+		c.Next()
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pkgx/httpx"
+	"pkgx/httpx/client"
+	"pkgx/httpx/trace"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	// the downstream service
+	var received http.Header
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer downstream.Close()
+	cli, err := client.NewClient(client.WithEndpoint(downstream.URL))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var sc trace.SpanContext
+	h := httpx.New(httpx.TimeOut(0)).Handle()
+	h.Use(RequestID())
+	h.GET("/call", func(c *httpx.Context) {
+		v, _ := c.Get(SpanContextKey)
+		sc = v.(trace.SpanContext)
+		id, _ := c.Get(RequestIDKey)
+		assert.Equal(t, sc.RequestID, id)
+		_, err := cli.Do(c.Request.Context(), http.MethodGet, "/", nil, client.TraceCall(c.Request.Context()))
+		assert.Nil(t, err)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/call", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, "req-1", sc.RequestID)
+	assert.Equal(t, "00f067aa0ba902b7", sc.ParentID.String())
+	assert.Equal(t, "req-1", w.Header().Get("X-Request-ID"))
+	assert.Equal(t, sc.Traceparent(), w.Header().Get("traceparent"))
+	// the downstream call continues the trace with the span of the service
+	assert.Equal(t, "req-1", received.Get("X-Request-ID"))
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+sc.SpanID.String()+"-01", received.Get("traceparent"))
+
+	// a request without the headers gets new ones
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/call", nil))
+	assert.Len(t, w.Header().Get("X-Request-ID"), 36)
+	assert.Equal(t, w.Header().Get("X-Request-ID"), received.Get("X-Request-ID"))
+	assert.False(t, sc.ParentID.IsValid())
+
+	// a call outside of a request starts a trace
+	_, err = cli.Do(context.Background(), http.MethodGet, "/", nil, client.TraceCall(context.Background()))
+	assert.Nil(t, err)
+	_, _, _, err = trace.ParseTraceparent(received.Get("traceparent"))
+	assert.Nil(t, err)
+}
+
+func TestRequestID_Stream(t *testing.T) {
+	var (
+		before, after trace.SpanContext
+		ok            bool
+	)
+	h := httpx.New(httpx.TimeOut(time.Second)).Handle()
+	h.Use(RequestID())
+	h.GET("/stream", func(c *httpx.Context) {
+		before, _ = trace.FromContext(c.Request.Context())
+		c.Stream(func(w io.Writer) bool {
+			io.WriteString(w, "tick")
+			return false
+		})
+		// the span is kept once the server timeout is lifted
+		after, ok = trace.FromContext(c.Request.Context())
+		assert.Nil(t, c.Request.Context().Err())
+		_, hasDeadline := c.Request.Context().Deadline()
+		assert.False(t, hasDeadline)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, "tick", w.Body.String())
+	assert.True(t, ok)
+	assert.Equal(t, "req-1", after.RequestID)
+	assert.Equal(t, before, after)
+}
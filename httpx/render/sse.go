@@ -0,0 +1,101 @@
+package render
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var sseContentType = []string{"text/event-stream"}
+
+var _ Render = (*SSE)(nil)
+
+// SSE is a Server-Sent Event. Data is written as is if it is a string or
+// bytes, as JSON otherwise, a multi-line data is split into data fields.
+type SSE struct {
+	Event string
+	Id    string
+	Retry uint
+	Data  any
+}
+
+func RenderSSE(event string, data any) *SSE {
+	return &SSE{
+		Event: event,
+		Data:  data,
+	}
+}
+
+// Parse encodes the event like the other renders, it panics if the data
+// cannot be encoded as JSON. Render returns the error instead.
+func (r *SSE) Parse() []byte {
+	b, err := r.encode()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Render writes the event, it returns the JSON error of the data before
+// anything is written.
+func (r *SSE) Render(w io.Writer) error {
+	b, err := r.encode()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (r *SSE) encode() ([]byte, error) {
+	var data []byte
+	switch d := r.Data.(type) {
+	case string:
+		data = []byte(d)
+	case []byte:
+		data = d
+	default:
+		var err error
+		if data, err = parseJSON(d); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if len(r.Id) > 0 {
+		buf.WriteString("id:")
+		buf.WriteString(sseField(r.Id))
+		buf.WriteByte('\n')
+	}
+	if len(r.Event) > 0 {
+		buf.WriteString("event:")
+		buf.WriteString(sseField(r.Event))
+		buf.WriteByte('\n')
+	}
+	if r.Retry > 0 {
+		buf.WriteString("retry:")
+		buf.WriteString(strconv.FormatUint(uint64(r.Retry), 10))
+		buf.WriteByte('\n')
+	}
+	for _, line := range bytes.Split(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n")) {
+		buf.WriteString("data:")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func (r *SSE) WriterContentType(w http.ResponseWriter) {
+	writeContentType(w, sseContentType)
+	if len(w.Header().Values("Cache-Control")) == 0 {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+}
+
+// sseField removes the line breaks of a field.
+func sseField(s string) string {
+	return strings.NewReplacer("\n", "", "\r", "").Replace(s)
+}
@@ -3,6 +3,8 @@ package httpx
 import (
 	"net/http"
 	"regexp"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -22,6 +24,30 @@ type Router struct {
 
 	// useRawPath if enabled, the url.RawPath will be used to find parameters.
 	useRawPath bool
+	// HandleMethodNotAllowed if enabled, a request whose path is registered
+	// with other methods is answered 405 with an Allow header.
+	HandleMethodNotAllowed bool
+	// HandleOPTIONS if enabled, an OPTIONS request to a path without an
+	// OPTIONS route is answered 204 with an Allow header.
+	HandleOPTIONS bool
+	// RedirectTrailingSlash if enabled, a request whose path only matches a
+	// route with or without the trailing slash is redirected to that route.
+	RedirectTrailingSlash bool
+	// RedirectFixedPath if enabled, a request without a route is redirected
+	// to the cleaned path, matched case-insensitively, if it has a route.
+	// e.g. /FOO and /..//Foo are redirected to /foo.
+	RedirectFixedPath bool
+	// RemoveExtraSlash if enabled, the request path is cleaned before the
+	// routes are looked up, e.g. /foo//bar/../baz is served as /foo/baz.
+	RemoveExtraSlash bool
+
+	// handlers of the requests without a route, combined with the global handlers
+	noRoute     HandlersChain
+	noMethod    HandlersChain
+	allNoRoute  HandlersChain
+	allNoMethod HandlersChain
+	allOptions  HandlersChain
+
 	// MaxMultipartMemory value of 'maxMemory' param that is given to http.Request's ParseMultipartForm
 	MaxMultipartMemory int64
 	// 记录所有路由中路径参数最多的数量
@@ -41,6 +67,7 @@ func NewRouter() *Router {
 		MaxMultipartMemory: defaultMultipartMemory,
 	}
 	r.Router = r
+	r.rebuildHandlers()
 	r.pool.New = func() any {
 		return r.newContext()
 	}
@@ -80,12 +107,88 @@ func (Router *Router) SetUseRawPath(b bool) {
 	Router.useRawPath = b
 }
 
+func (Router *Router) SetHandleMethodNotAllowed(b bool) {
+	Router.HandleMethodNotAllowed = b
+}
+
+func (Router *Router) SetHandleOPTIONS(b bool) {
+	Router.HandleOPTIONS = b
+}
+
+func (Router *Router) SetRedirectTrailingSlash(b bool) {
+	Router.RedirectTrailingSlash = b
+}
+
+func (Router *Router) SetRedirectFixedPath(b bool) {
+	Router.RedirectFixedPath = b
+}
+
+func (Router *Router) SetRemoveExtraSlash(b bool) {
+	Router.RemoveExtraSlash = b
+}
+
+// NoRoute sets the handlers of the requests that match no route, they run
+// after the global handlers. Default404Body is written if they leave the
+// response untouched.
+func (Router *Router) NoRoute(handlers ...HandlerFunc) {
+	Router.noRoute = handlers
+	Router.rebuildHandlers()
+}
+
+// NoMethod sets the handlers of the requests whose path is only registered
+// with other methods, they run after the global handlers. Default405Body is
+// written if they leave the response untouched.
+func (Router *Router) NoMethod(handlers ...HandlerFunc) {
+	Router.noMethod = handlers
+	Router.rebuildHandlers()
+}
+
+// rebuildHandlers combines the global handlers with the handlers of the
+// requests without a route.
+func (Router *Router) rebuildHandlers() {
+	Router.allNoRoute = Router.combineHandlers(Router.noRoute)
+	Router.allNoMethod = Router.combineHandlers(Router.noMethod)
+	Router.allOptions = Router.combineHandlers(HandlersChain{handleOptions})
+}
+
+// handleOptions answers an OPTIONS request without a route.
+func handleOptions(c *Context) {
+	c.ResponseWithCode(http.StatusNoContent)
+}
+
+// allowed returns the methods registered for a path, sorted and separated by
+// commas, OPTIONS is included when it is answered automatically.
+func (Router *Router) allowed(c *Context, path, reqMethod string) string {
+	allowed := make([]string, 0, len(Router.trees)+1)
+	options := false
+	for _, tree := range Router.trees {
+		if tree.method == reqMethod {
+			continue
+		}
+		*c.skippedNodes = (*c.skippedNodes)[:0]
+		if value := tree.root.getValue(path, nil, c.skippedNodes, false); value.handlers != nil {
+			allowed = append(allowed, tree.method)
+			options = options || tree.method == http.MethodOptions
+		}
+	}
+	if len(allowed) == 0 {
+		return ""
+	}
+
+	if Router.HandleOPTIONS && !options {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	sort.Strings(allowed)
+	return strings.Join(allowed, ", ")
+}
+
 func (Router *Router) SetMaxMultipartMemory(size int64) {
 	Router.MaxMultipartMemory = size
 }
 
 type IRouters interface {
 	Use(...HandlerFunc) IRouters
+	Group(string, ...HandlerFunc) *IRouter
 	Handle(string, string, ...HandlerFunc) IRouters
 	GET(string, ...HandlerFunc) IRouters
 	POST(string, ...HandlerFunc) IRouters
@@ -93,6 +196,9 @@ type IRouters interface {
 	PUT(string, ...HandlerFunc) IRouters
 	OPTIONS(string, ...HandlerFunc) IRouters
 	HEAD(string, ...HandlerFunc) IRouters
+	StaticFile(string, string) IRouters
+	Static(string, string) IRouters
+	StaticFS(string, http.FileSystem) IRouters
 }
 
 type IRouter struct {
@@ -109,12 +215,30 @@ func (Router *IRouter) Use(middleware ...HandlerFunc) IRouters {
 	size := len(Router.Handlers) + len(middleware)
 	if size > int(abortIndex) {
 		panic("http handlers exceed the limit")
-		return Router
 	}
 	Router.Handlers = append(Router.Handlers, middleware...)
+	if Router.Router != nil && Router == &Router.Router.IRouter {
+		Router.Router.rebuildHandlers()
+	}
 	return Router
 }
 
+// Group creates a new router group. The routes of the group share the relative
+// path as a prefix and run the group handlers after those of the parent, e.g.
+//
+//	api := router.Group("/api/v1", auth)
+//	api.GET("/users", listUsers) // GET /api/v1/users runs auth, listUsers
+//
+// The handlers of a group are combined when a route is registered, Use has
+// no effect on the routes already registered.
+func (Router *IRouter) Group(relativePath string, handlers ...HandlerFunc) *IRouter {
+	return &IRouter{
+		Router:   Router.Router,
+		basePath: Router.generateAbsolutePath(relativePath),
+		Handlers: Router.combineHandlers(handlers),
+	}
+}
+
 func (Router *IRouter) Handle(httpMethod, relativePath string, handlers ...HandlerFunc) IRouters {
 	if matched := regEnLetter.MatchString(httpMethod); !matched {
 		panic("http method " + httpMethod + " is not valid")
@@ -0,0 +1,166 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serve runs a request through a handler and returns the response.
+func serve(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+// trace returns a handler that appends its name to the trace header.
+func trace(name string) HandlerFunc {
+	return func(c *Context) {
+		c.Writer.Header().Add("X-Trace", name)
+	}
+}
+
+func TestIRouter_Group(t *testing.T) {
+	h := httpHandler()
+	h.WithLogger(DefaultLogger)
+	h.Use(trace("root"))
+
+	api := h.Group("/api/v1", trace("auth"))
+	api.GET("/users", trace("users"))
+
+	admin := api.Group("admin", trace("admin"))
+	admin.Use(trace("audit"))
+	admin.POST("/users/:id", func(c *Context) {
+		c.Writer.Header().Add("X-Trace", c.GetParam("id"))
+	})
+
+	h.GET("/health", trace("health"))
+
+	w := serve(h, http.MethodGet, "/api/v1/users")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"root", "auth", "users"}, w.Header().Values("X-Trace"))
+
+	w = serve(h, http.MethodPost, "/api/v1/admin/users/42")
+	assert.Equal(t, []string{"root", "auth", "admin", "audit", "42"}, w.Header().Values("X-Trace"))
+
+	// the group handlers do not leak into the parent
+	w = serve(h, http.MethodGet, "/health")
+	assert.Equal(t, []string{"root", "health"}, w.Header().Values("X-Trace"))
+
+	assert.Equal(t, "/api/v1/admin", admin.BasePath())
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/users").Code)
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	h := httpHandler()
+	h.WithLogger(DefaultLogger)
+	h.Use(trace("root"))
+	h.GET("/users/:id", trace("get"))
+	h.PUT("/users/:id", trace("put"))
+	h.OPTIONS("/custom", trace("options"))
+	h.DELETE("/custom", trace("delete"))
+
+	// the 405 and the automatic OPTIONS answers are enabled by the options
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodPost, "/users/1").Code)
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodOptions, "/users/1").Code)
+	h.SetHandleMethodNotAllowed(true)
+	h.SetHandleOPTIONS(true)
+
+	w := serve(h, http.MethodPost, "/users/1")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, OPTIONS, PUT", w.Header().Get(HeaderAllow))
+	assert.Equal(t, string(Default405Body), w.Body.String())
+	assert.Equal(t, []string{"root"}, w.Header().Values("X-Trace"))
+
+	// automatic OPTIONS answers run the global handlers
+	w = serve(h, http.MethodOptions, "/users/1")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, OPTIONS, PUT", w.Header().Get(HeaderAllow))
+	assert.Equal(t, []string{"root"}, w.Header().Values("X-Trace"))
+
+	// a registered OPTIONS route wins
+	w = serve(h, http.MethodOptions, "/custom")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"root", "options"}, w.Header().Values("X-Trace"))
+	assert.Equal(t, "DELETE, OPTIONS", serve(h, http.MethodGet, "/custom").Header().Get(HeaderAllow))
+
+	w = serve(h, http.MethodGet, "/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, string(Default404Body), w.Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodOptions, "/missing").Code)
+
+}
+
+func TestRouter_NoRoute(t *testing.T) {
+	h := httpHandler()
+	h.WithLogger(DefaultLogger)
+	h.GET("/users", trace("users"))
+	h.NoRoute(func(c *Context) {
+		c.ResponseWithCodeMessage(http.StatusNotFound, []byte("custom 404"))
+	})
+	h.NoMethod(trace("no-method"))
+	h.SetHandleMethodNotAllowed(true)
+	// global handlers added later still run for the requests without a route
+	h.Use(trace("root"))
+
+	w := serve(h, http.MethodGet, "/missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "custom 404", w.Body.String())
+	assert.Equal(t, []string{"root"}, w.Header().Values("X-Trace"))
+
+	// the default body is written when the handlers leave the response untouched
+	w = serve(h, http.MethodPost, "/users")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, string(Default405Body), w.Body.String())
+	assert.Equal(t, []string{"root", "no-method"}, w.Header().Values("X-Trace"))
+
+	h.NoMethod(func(c *Context) {
+		c.ResponseWithCode(http.StatusTeapot)
+	})
+	assert.Equal(t, http.StatusTeapot, serve(h, http.MethodPost, "/users").Code)
+}
+
+func TestRouter_Redirect(t *testing.T) {
+	h := httpHandler()
+	h.WithLogger(DefaultLogger)
+	h.GET("/users", trace("users"))
+	h.POST("/users/:id/", trace("user"))
+	h.GET("/static/*filepath", trace("static"))
+
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/users/").Code)
+	h.SetRedirectTrailingSlash(true)
+	w := serve(h, http.MethodGet, "/users/?page=2")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/users?page=2", w.Header().Get("Location"))
+
+	// the other methods keep their method and body
+	w = serve(h, http.MethodPost, "/users/1")
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+	assert.Equal(t, "/users/1/", w.Header().Get("Location"))
+
+	// the case and the extra slashes are only fixed when enabled
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/Users/").Code)
+	h.SetRedirectFixedPath(true)
+	w = serve(h, http.MethodGet, "/Users/")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/users", w.Header().Get("Location"))
+	w = serve(h, http.MethodGet, "/a/..//USERS")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/users", w.Header().Get("Location"))
+
+	// a path cannot redirect to another host
+	w = serve(h, http.MethodGet, "//users/")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/users", w.Header().Get("Location"))
+
+	h.SetRemoveExtraSlash(true)
+	w = serve(h, http.MethodGet, "/static//css/../app.css")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"static"}, w.Header().Values("X-Trace"))
+
+	h.SetRedirectTrailingSlash(false)
+	h.SetRedirectFixedPath(false)
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/users/").Code)
+}
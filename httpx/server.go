@@ -10,12 +10,13 @@ type Server interface {
 	Stop(context.Context) error
 }
 
-//type Instance interface {
-//	ID() string
-//	Name() string
-//	Version() string
-//	Endpoint() []string
-//}
+// Instance is the metadata of a running server.
+type Instance interface {
+	ID() string
+	Name() string
+	Version() string
+	Endpoint() []string
+}
 
 func ExtractEndpoint(address string) (string, error) {
 	host, port, err := net.SplitHostPort(address)
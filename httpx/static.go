@@ -0,0 +1,94 @@
+package httpx
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// StaticFile registers a GET and HEAD route serving a single file of the
+// local file system, e.g. router.StaticFile("/favicon.ico", "./assets/favicon.ico").
+func (Router *IRouter) StaticFile(relativePath, filepath string) IRouters {
+	if strings.ContainsAny(relativePath, ":*") {
+		panic("URL parameters can not be used when serving a static file")
+	}
+	handler := func(c *Context) {
+		c.File(filepath)
+	}
+	Router.GET(relativePath, handler)
+	Router.HEAD(relativePath, handler)
+	return Router
+}
+
+// Static serves the files of a local directory under relativePath, e.g.
+// router.Static("/assets", "./dist/assets"). Directories are not listed,
+// their index.html is served instead.
+func (Router *IRouter) Static(relativePath, root string) IRouters {
+	return Router.StaticFS(relativePath, http.Dir(root))
+}
+
+// StaticFS serves the files of a file system under relativePath, like
+// Static. Range, If-Modified-Since and If-None-Match requests are answered
+// by http.ServeContent.
+func (Router *IRouter) StaticFS(relativePath string, fs http.FileSystem) IRouters {
+	if strings.ContainsAny(relativePath, ":*") {
+		panic("URL parameters can not be used when serving a static folder")
+	}
+	handler := func(c *Context) {
+		if !serveFile(c, fs, c.GetParam("filepath")) {
+			c.ResponseWithCodeMessage(http.StatusNotFound, Default404Body)
+		}
+	}
+	urlPattern := path.Join(relativePath, "/*filepath")
+	Router.GET(urlPattern, handler)
+	Router.HEAD(urlPattern, handler)
+	return Router
+}
+
+// SPA serves a built single page application from a file system. The GET
+// and HEAD requests without a route are answered with the file at their
+// path, or with /index.html if the path has no extension so that the client
+// side router handles it. It replaces the NoRoute handlers.
+func (Router *Router) SPA(fs http.FileSystem) {
+	Router.NoRoute(func(c *Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			return
+		}
+		name := c.Request.URL.Path
+		if !serveFile(c, fs, name) && path.Ext(name) == "" {
+			serveFile(c, fs, "/index.html")
+		}
+	})
+}
+
+// serveFile serves a file of fs, or the index.html of a directory, it
+// reports false if there is no such file.
+func serveFile(c *Context, fs http.FileSystem, name string) bool {
+	name = path.Clean("/" + name)
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	d, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	if d.IsDir() {
+		index, err := fs.Open(path.Join(name, "index.html"))
+		if err != nil {
+			return false
+		}
+		defer index.Close()
+		if d, err = index.Stat(); err != nil || d.IsDir() {
+			return false
+		}
+		f = index
+	}
+
+	// the files may be large, they are not buffered by Timeout
+	c.LiftTimeout()
+	http.ServeContent(c.Writer, c.Request, d.Name(), d.ModTime(), f)
+	return true
+}
@@ -0,0 +1,91 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles creates the files of a directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(p), 0750))
+		assert.Nil(t, os.WriteFile(p, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestIRouter_Static(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"index.html":      "<html>home</html>",
+		"docs/a.txt":      "0123456789",
+		"docs/index.html": "docs",
+		"empty/x.txt":     "x",
+	})
+
+	h := httpHandler()
+	h.WithLogger(DefaultLogger)
+	h.Static("/static", dir)
+	h.StaticFile("/favicon.ico", filepath.Join(dir, "docs/a.txt"))
+
+	w := serve(h, http.MethodGet, "/static/docs/a.txt")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+
+	req := httptest.NewRequest(http.MethodGet, "/static/docs/a.txt", nil)
+	req.Header.Set("Range", "bytes=2-4")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "234", w.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/static/docs/a.txt", nil)
+	req.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// directories serve their index.html and are not listed
+	assert.Equal(t, "docs", serve(h, http.MethodGet, "/static/docs/").Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/static/empty/").Code)
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/static/missing.txt").Code)
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/static/../static_test.go").Code)
+
+	w = serve(h, http.MethodHead, "/favicon.ico")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Empty(t, w.Body.String())
+}
+
+func TestRouter_SPA(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"index.html":    "<html>app</html>",
+		"assets/app.js": "app()",
+	})
+
+	h := httpHandler()
+	h.WithLogger(DefaultLogger)
+	h.GET("/api/users", trace("users"))
+	h.SPA(http.Dir(dir))
+
+	assert.Equal(t, []string{"users"}, serve(h, http.MethodGet, "/api/users").Header().Values("X-Trace"))
+	assert.Equal(t, "app()", serve(h, http.MethodGet, "/assets/app.js").Body.String())
+
+	// the paths of the client side router get the application
+	w := serve(h, http.MethodGet, "/users/42")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<html>app</html>", w.Body.String())
+	assert.Equal(t, "<html>app</html>", serve(h, http.MethodGet, "/").Body.String())
+
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/assets/missing.js").Code)
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodPost, "/users/42").Code)
+}
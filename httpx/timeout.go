@@ -0,0 +1,363 @@
+package httpx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var errHijackTimeout = errors.New("httpx: hijack of a response under a timeout, call LiftTimeout first")
+
+type timeoutConfig struct {
+	code        int
+	contentType string
+	body        []byte
+}
+
+type TimeoutOption func(cfg *timeoutConfig)
+
+// TimeoutCode sets the status of the timed out requests, 503 by default.
+func TimeoutCode(code int) TimeoutOption {
+	return func(cfg *timeoutConfig) {
+		cfg.code = code
+	}
+}
+
+// TimeoutResponse sets the body of the timed out requests, the status text
+// by default.
+func TimeoutResponse(contentType string, body []byte) TimeoutOption {
+	return func(cfg *timeoutConfig) {
+		cfg.contentType = contentType
+		cfg.body = body
+	}
+}
+
+// Timeout returns a middleware running the next handlers with a deadline,
+// on a route, a group or the whole server, see TimeOut. The output of the
+// handlers is buffered and written once they return, when the deadline
+// passes first the timeout response is written instead and the late writes
+// of the handlers fail with http.ErrHandlerTimeout. When the client goes
+// away first nothing is written.
+//
+// The handlers run on a copy of the Context in their own goroutine, the
+// changes of Keys and the abort are kept once they return in time. A
+// handler calling LiftTimeout, e.g. through Stream, SSEvent, Upgrade or
+// the file responses, writes its output directly and is no longer timed.
+func Timeout(timeout time.Duration, opts ...TimeoutOption) HandlerFunc {
+	cfg := &timeoutConfig{
+		code: http.StatusServiceUnavailable,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.body == nil {
+		cfg.contentType = ContentTypeTextPlain + "; charset=utf-8"
+		cfg.body = []byte(http.StatusText(cfg.code))
+	}
+
+	return func(c *Context) {
+		req := c.Request
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		tw := newTimeoutWriter(c.Writer)
+		cc := c.fork(tw, req.WithContext(ctx))
+		finished := make(chan any, 1)
+		go func() {
+			defer func() {
+				p := recover()
+				if p != nil && tw.isTimedOut() {
+					cc.Log.Errorf("http handler panic after timeout: %v", p)
+				}
+				finished <- p
+			}()
+			cc.Next()
+		}()
+
+		select {
+		case p := <-finished:
+			c.join(cc, req, tw, p)
+		case <-ctx.Done():
+			if !tw.timeout() {
+				// the timeout has been lifted
+				c.join(cc, req, tw, <-finished)
+				return
+			}
+			c.Request = req
+			if ctx.Err() != context.DeadlineExceeded || req.Context().Err() != nil {
+				// the client went away or an enclosing deadline passed, the
+				// handlers stop with the context and nothing is written
+				<-finished
+				c.Abort()
+				return
+			}
+			c.Log.Errorf("http handler timeout after %s: %s %s", timeout, req.Method, req.URL.Path)
+			if cfg.contentType != "" {
+				c.Writer.Header().Set(HeaderContentType, cfg.contentType)
+			}
+			c.Writer.WriteHeader(cfg.code)
+			if _, err := c.Writer.Write(cfg.body); err != nil {
+				c.Log.Errorf("http timeout response write error:%v", err)
+			}
+			c.Abort()
+		}
+	}
+}
+
+// fork copies the Context to run the next handlers in another goroutine.
+func (c *Context) fork(w ResponseWriter, r *http.Request) *Context {
+	cc := &Context{
+		Log:        c.Log,
+		Request:    r,
+		Writer:     w,
+		router:     c.router,
+		index:      c.index,
+		fullPath:   c.fullPath,
+		handlers:   c.handlers,
+		queryCache: c.queryCache,
+		formCache:  c.formCache,
+		sameSite:   c.sameSite,
+		Params:     append(Params(nil), c.Params...),
+		untimed:    c.untimed,
+	}
+	// LiftTimeout takes the deadline and cancellation of the context before
+	// the outermost Timeout, the values of the request context are kept
+	if cc.untimed == nil {
+		cc.untimed = c.Request.Context()
+	}
+	c.mu.RLock()
+	if c.Keys != nil {
+		cc.Keys = make(map[string]any, len(c.Keys))
+		for k, v := range c.Keys {
+			cc.Keys[k] = v
+		}
+	}
+	c.mu.RUnlock()
+	return cc
+}
+
+// join takes back the state of a fork that returned, p is its panic.
+func (c *Context) join(cc *Context, req *http.Request, tw *timeoutWriter, p any) {
+	c.Request = req
+	if p != nil {
+		panic(p)
+	}
+	tw.commit()
+	c.mu.Lock()
+	c.Keys = cc.Keys
+	c.mu.Unlock()
+	c.queryCache = cc.queryCache
+	c.formCache = cc.formCache
+	c.index = cc.index
+}
+
+// liftedContext keeps the values of a request context, its deadline and
+// cancellation are the ones of the context before the Timeout middlewares.
+type liftedContext struct {
+	context.Context
+	untimed context.Context
+}
+
+func (c liftedContext) Deadline() (time.Time, bool) {
+	return c.untimed.Deadline()
+}
+
+func (c liftedContext) Done() <-chan struct{} {
+	return c.untimed.Done()
+}
+
+func (c liftedContext) Err() error {
+	return c.untimed.Err()
+}
+
+// timeoutWriter buffers a response until the handlers return, or until the
+// timeout is lifted.
+type timeoutWriter struct {
+	dst ResponseWriter
+
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	status      int
+	size        int
+	timedOut    bool
+	passthrough bool
+}
+
+var _ ResponseWriter = &timeoutWriter{}
+
+func newTimeoutWriter(dst ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{
+		dst:    dst,
+		header: dst.Header().Clone(),
+		// keep the status set before, e.g. the 404 of the NoRoute handlers
+		status: dst.Status(),
+		size:   noWritten,
+	}
+}
+
+func (w *timeoutWriter) reset(http.ResponseWriter) {}
+
+func (w *timeoutWriter) Header() http.Header {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.passthrough {
+		return w.dst.Header()
+	}
+	return w.header
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.passthrough {
+		return w.dst.Status()
+	}
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.passthrough {
+		return w.dst.Size()
+	}
+	return w.size
+}
+
+func (w *timeoutWriter) Written() bool {
+	return w.Size() != noWritten
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case w.passthrough:
+		w.dst.WriteHeader(code)
+	case !w.timedOut && w.size == noWritten && code > 0:
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.passthrough {
+		w.dst.WriteHeaderNow()
+		return
+	}
+	if w.size == noWritten {
+		w.size = 0
+	}
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case w.passthrough:
+		return w.dst.Write(data)
+	case w.timedOut:
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.size == noWritten {
+		w.size = 0
+	}
+	n, err := w.buf.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Hijack implements the http.Hijacker interface once the timeout is lifted.
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.passthrough {
+		return nil, nil, errHijackTimeout
+	}
+	return w.dst.Hijack()
+}
+
+// Flush implements the http.Flusher interface, the buffered output is only
+// flushed once the timeout is lifted.
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.passthrough {
+		w.dst.Flush()
+	}
+}
+
+// timeout marks the response as timed out, it reports false if the timeout
+// has been lifted.
+func (w *timeoutWriter) timeout() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.passthrough {
+		return false
+	}
+	w.timedOut = true
+	return true
+}
+
+func (w *timeoutWriter) isTimedOut() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.timedOut
+}
+
+// lift writes the buffered output and passes the next writes through, the
+// timeouts of the enclosing writers are lifted too.
+func (w *timeoutWriter) lift() {
+	w.mu.Lock()
+	if w.timedOut || w.passthrough {
+		w.mu.Unlock()
+		return
+	}
+	w.flushBuffer()
+	w.passthrough = true
+	w.mu.Unlock()
+
+	if dst, ok := w.dst.(*timeoutWriter); ok {
+		dst.lift()
+	}
+}
+
+// commit writes the buffered output once the handlers returned in time.
+func (w *timeoutWriter) commit() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.passthrough {
+		w.flushBuffer()
+	}
+}
+
+func (w *timeoutWriter) flushBuffer() {
+	header := w.dst.Header()
+	for k := range header {
+		if _, ok := w.header[k]; !ok {
+			delete(header, k)
+		}
+	}
+	for k, v := range w.header {
+		header[k] = v
+	}
+	w.dst.WriteHeader(w.status)
+	if w.size == noWritten {
+		return
+	}
+	if _, err := w.dst.Write(w.buf.Bytes()); err != nil {
+		return
+	}
+	w.buf.Reset()
+}
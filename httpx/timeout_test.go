@@ -0,0 +1,205 @@
+package httpx
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	h := httpHandler()
+	h.WithLogger(DefaultLogger)
+	var user any
+	h.Use(func(c *Context) {
+		c.Header("X-Before", "1")
+		c.Next()
+		user, _ = c.Get("user")
+	})
+	lateErr := make(chan error, 1)
+
+	api := h.Group("/api", Timeout(50*time.Millisecond), func(c *Context) {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), ctxKey{}, "v"))
+		c.Next()
+	})
+	api.GET("/fast", func(c *Context) {
+		c.Set("user", "u1")
+		c.Header("X-Handler", "fast")
+		c.ResponseWithCodeMessage(http.StatusCreated, []byte("fast"))
+		c.Abort()
+	}, func(c *Context) {
+		// the abort of the handlers is kept
+		t.Error("handler after abort")
+	})
+	api.GET("/slow", func(c *Context) {
+		c.Header("X-Handler", "slow")
+		c.ResponseWithCodeMessage(http.StatusOK, []byte("partial"))
+		<-c.Request.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		_, err := c.Writer.Write([]byte("late"))
+		lateErr <- err
+	})
+	api.GET("/stream", func(c *Context) {
+		c.Header("X-Handler", "stream")
+		n := 0
+		c.Stream(func(w io.Writer) bool {
+			time.Sleep(20 * time.Millisecond)
+			io.WriteString(w, "tick ")
+			n++
+			return n < 5
+		})
+		// the values set under the timeout are kept
+		assert.Nil(t, c.Request.Context().Err())
+		assert.Equal(t, "v", c.Request.Context().Value(ctxKey{}))
+		_, ok := c.Request.Context().Deadline()
+		assert.False(t, ok)
+	})
+	api.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+	h.GET("/custom", Timeout(time.Millisecond, TimeoutCode(http.StatusGatewayTimeout), TimeoutResponse(ContentTypeApplicationJson, []byte(`{"code":504}`))), func(c *Context) {
+		<-c.Request.Context().Done()
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := serve("/api/fast")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "fast", w.Body.String())
+	assert.Equal(t, "fast", w.Header().Get("X-Handler"))
+	assert.Equal(t, "1", w.Header().Get("X-Before"))
+	assert.Equal(t, "u1", user)
+
+	w = serve("/api/slow")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "Service Unavailable", w.Body.String())
+	assert.Empty(t, w.Header().Get("X-Handler"))
+	assert.Equal(t, "1", w.Header().Get("X-Before"))
+	assert.Equal(t, http.ErrHandlerTimeout, <-lateErr)
+
+	// the streaming output is not timed
+	w = serve("/api/stream")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "tick tick tick tick tick ", w.Body.String())
+	assert.Equal(t, "stream", w.Header().Get("X-Handler"))
+	assert.True(t, w.Flushed)
+
+	w = serve("/custom")
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, `{"code":504}`, w.Body.String())
+	assert.Equal(t, ContentTypeApplicationJson, w.Header().Get(HeaderContentType))
+
+	// a client going away is not a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	w = httptest.NewRecorder()
+	gone := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/slow", nil).WithContext(ctx))
+		close(gone)
+	}()
+	cancel()
+	<-gone
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, http.ErrHandlerTimeout, <-lateErr)
+
+	// the panics reach the enclosing handlers
+	assert.PanicsWithValue(t, "boom", func() {
+		serve("/api/panic")
+	})
+}
+
+func TestTimeout_Nested(t *testing.T) {
+	srv := New(TimeOut(30 * time.Millisecond))
+	srv.Handle().GET("/long", Timeout(time.Second), func(c *Context) {
+		time.Sleep(60 * time.Millisecond)
+		c.ResponseWithCodeMessage(http.StatusOK, []byte("long"))
+	})
+	srv.Handle().GET("/sse", Timeout(10*time.Millisecond), func(c *Context) {
+		for i := 0; i < 3; i++ {
+			c.SSEvent("tick", i)
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+
+	// the server timeout still applies
+	w := httptest.NewRecorder()
+	srv.Handle().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/long", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// the timeouts of all the middlewares are lifted
+	w = httptest.NewRecorder()
+	srv.Handle().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sse", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "event:tick\ndata:0\n\nevent:tick\ndata:1\n\nevent:tick\ndata:2\n\n", w.Body.String())
+}
+
+func TestTimeout_Server(t *testing.T) {
+	var status int
+	srv := New(TimeOut(30*time.Millisecond), Middleware(func(c *Context) {
+		c.Next()
+		status = c.Writer.Status()
+	}))
+	h := srv.Handle().(RouterHandler)
+	h.SetHandleMethodNotAllowed(true)
+	h.GET("/slow", func(c *Context) {
+		time.Sleep(60 * time.Millisecond)
+		c.ResponseWithCodeMessage(http.StatusOK, []byte("slow"))
+	})
+	h.StaticFS("/static", slowFS{http.FS(fstest.MapFS{"file.txt": {Data: []byte("file")}})})
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// the error answers of the router keep their status
+	w := serve(http.MethodGet, "/nope")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "404 page not found", w.Body.String())
+	assert.Equal(t, http.StatusNotFound, status)
+	w = serve(http.MethodPost, "/slow")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "405 method not allowed", w.Body.String())
+	assert.Equal(t, "GET", w.Header().Get(HeaderAllow))
+
+	// the server middleware sees the timeout answer
+	w = serve(http.MethodGet, "/slow")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	// the files are not timed
+	w = serve(http.MethodGet, "/static/file.txt")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "file", w.Body.String())
+}
+
+type ctxKey struct{}
+
+// slowFS serves files slower than the server timeout.
+type slowFS struct {
+	http.FileSystem
+}
+
+func (fs slowFS) Open(name string) (http.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	return slowFile{f}, err
+}
+
+type slowFile struct {
+	http.File
+}
+
+func (f slowFile) Read(p []byte) (int, error) {
+	time.Sleep(60 * time.Millisecond)
+	return f.File.Read(p)
+}
@@ -0,0 +1,181 @@
+// Package trace carries the request ID and the W3C trace context of a
+// request across the services, https://www.w3.org/TR/trace-context/.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const (
+	HeaderRequestID   = "X-Request-ID"
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+
+	// FlagSampled is the sampled flag of the trace flags.
+	FlagSampled byte = 0x01
+
+	maxRequestIDLen = 128
+)
+
+var errTraceparent = errors.New("trace: invalid traceparent")
+
+// TraceID identifies a trace, it is shared by all the services.
+type TraceID [16]byte
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies the part of a trace served by a service.
+type SpanID [8]byte
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext is the trace context of a request in a service.
+type SpanContext struct {
+	// RequestID identifies the request, it is kept across the services.
+	RequestID string
+	TraceID   TraceID
+	// SpanID is the span of the service, ParentID the span of the caller,
+	// zero for a new trace.
+	SpanID   SpanID
+	ParentID SpanID
+	Flags    byte
+	// State is the vendor data of the tracestate header, it is forwarded.
+	State string
+}
+
+// Traceparent returns the traceparent header of the calls of the service.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// Inject sets the headers of a call of the service.
+func (sc SpanContext) Inject(header http.Header) {
+	if sc.RequestID != "" {
+		header.Set(HeaderRequestID, sc.RequestID)
+	}
+	if sc.TraceID.IsValid() && sc.SpanID.IsValid() {
+		header.Set(HeaderTraceparent, sc.Traceparent())
+	}
+	if sc.State != "" {
+		header.Set(HeaderTracestate, sc.State)
+	}
+}
+
+// Extract returns the span of a service for the headers of a request: the
+// trace of the caller is continued with a new span, a request without a
+// valid request ID or trace gets new ones.
+func Extract(header http.Header) SpanContext {
+	sc := SpanContext{
+		RequestID: header.Get(HeaderRequestID),
+		Flags:     FlagSampled,
+	}
+	if !validRequestID(sc.RequestID) {
+		sc.RequestID = uuid.New().String()
+	}
+	if traceID, parentID, flags, err := ParseTraceparent(header.Get(HeaderTraceparent)); err == nil {
+		sc.TraceID, sc.ParentID, sc.Flags = traceID, parentID, flags
+		sc.State = header.Get(HeaderTracestate)
+	} else {
+		sc.TraceID = newTraceID()
+	}
+	sc.SpanID = newSpanID()
+	return sc
+}
+
+// New returns the span of a new trace, e.g. for the calls of a job.
+func New() SpanContext {
+	return SpanContext{
+		RequestID: uuid.New().String(),
+		TraceID:   newTraceID(),
+		SpanID:    newSpanID(),
+		Flags:     FlagSampled,
+	}
+}
+
+// ParseTraceparent parses a traceparent header, version-traceid-parentid-flags.
+func ParseTraceparent(s string) (traceID TraceID, parentID SpanID, flags byte, err error) {
+	// the later versions may append fields
+	if len(s) < 55 || len(s) > 55 && (s[:2] == "00" || s[55] != '-') {
+		return traceID, parentID, 0, errTraceparent
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' || s[:2] == "ff" {
+		return traceID, parentID, 0, errTraceparent
+	}
+	var version, f [1]byte
+	if !decodeHex(version[:], s[:2]) || !decodeHex(traceID[:], s[3:35]) || !decodeHex(parentID[:], s[36:52]) || !decodeHex(f[:], s[53:55]) {
+		return traceID, parentID, 0, errTraceparent
+	}
+	if !traceID.IsValid() || !parentID.IsValid() {
+		return traceID, parentID, 0, errTraceparent
+	}
+	return traceID, parentID, f[0], nil
+}
+
+type spanKey struct{}
+
+// NewContext returns a context carrying a span.
+func NewContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// FromContext returns the span of a context.
+func FromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanKey{}).(SpanContext)
+	return sc, ok
+}
+
+// validRequestID reports whether a request ID is safe to log and forward.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeHex decodes lowercase hex digits.
+func decodeHex(dst []byte, s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,74 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, parentID, flags, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Nil(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", parentID.String())
+	assert.Equal(t, FlagSampled, flags)
+
+	// a later version may append fields
+	_, _, _, err = ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-what")
+	assert.Nil(t, err)
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-3600f067aa0ba902b7-01",
+	} {
+		_, _, _, err = ParseTraceparent(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	header := http.Header{}
+	header.Set(HeaderRequestID, "req-1")
+	header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	header.Set(HeaderTracestate, "vendor=1")
+	sc := Extract(header)
+	assert.Equal(t, "req-1", sc.RequestID)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.ParentID.String())
+	assert.True(t, sc.SpanID.IsValid())
+	assert.NotEqual(t, sc.ParentID, sc.SpanID)
+	assert.Equal(t, "vendor=1", sc.State)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+sc.SpanID.String()+"-00", sc.Traceparent())
+
+	// the invalid values are replaced
+	header = http.Header{}
+	header.Set(HeaderRequestID, "bad id\n")
+	header.Set(HeaderTraceparent, "00-bad")
+	header.Set(HeaderTracestate, "vendor=1")
+	sc = Extract(header)
+	assert.Len(t, sc.RequestID, 36)
+	assert.True(t, sc.TraceID.IsValid())
+	assert.False(t, sc.ParentID.IsValid())
+	assert.Empty(t, sc.State)
+	assert.Equal(t, FlagSampled, sc.Flags)
+
+	out := http.Header{}
+	sc.Inject(out)
+	assert.Equal(t, sc.RequestID, out.Get(HeaderRequestID))
+	assert.Equal(t, sc.Traceparent(), out.Get(HeaderTraceparent))
+
+	ctx := NewContext(context.Background(), sc)
+	got, ok := FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, sc, got)
+	_, ok = FromContext(context.Background())
+	assert.False(t, ok)
+}
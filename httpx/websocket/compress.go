@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// deflateTail ends a message compressed with a sync flush, followed by an
+// empty final block so that the reader sees the end of the stream.
+const deflateTail = "\x00\x00\xff\xff\x01\x00\x00\xff\xff"
+
+var flateWriterPool = sync.Pool{New: func() any {
+	w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return w
+}}
+
+// compressMessage compresses a message without context takeover, RFC 7692
+// section 7.2.1.
+func compressMessage(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	fw := flateWriterPool.Get().(*flate.Writer)
+	defer flateWriterPool.Put(fw)
+	fw.Reset(&buf)
+	if _, err := fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte(deflateTail[:4])), nil
+}
+
+// decompressMessage decompresses a message of at most limit bytes, no limit
+// if it is 0.
+func decompressMessage(data []byte, limit int64) ([]byte, error) {
+	fr := flate.NewReader(io.MultiReader(bytes.NewReader(data), strings.NewReader(deflateTail)))
+	defer fr.Close()
+	if limit <= 0 {
+		return ioutil.ReadAll(fr)
+	}
+	p, err := ioutil.ReadAll(io.LimitReader(fr, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(p)) > limit {
+		return nil, ErrReadLimit
+	}
+	return p, nil
+}
+
+// negotiateDeflate reports whether the client offers permessage-deflate
+// with parameters the server accepts. The server never takes over the
+// context and asks the client not to.
+func negotiateDeflate(offers []string) bool {
+	for _, header := range offers {
+		for _, offer := range strings.Split(header, ",") {
+			params := strings.Split(offer, ";")
+			if strings.TrimSpace(params[0]) != "permessage-deflate" {
+				continue
+			}
+			if acceptDeflateParams(params[1:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func acceptDeflateParams(params []string) bool {
+	for _, param := range params {
+		name, _, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch strings.TrimSpace(name) {
+		case "server_no_context_takeover", "client_no_context_takeover":
+		case "client_max_window_bits":
+			// the reader accepts any window
+		default:
+			// server_max_window_bits is declined, the writer always uses
+			// a 32KB window
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,551 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The message types, RFC 6455 section 11.8.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// The close codes, RFC 6455 section 11.7.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+	CloseServiceRestart          = 1012
+	CloseTryAgainLater           = 1013
+	CloseTLSHandshake            = 1015
+)
+
+const (
+	finalBit = 1 << 7
+	rsv1Bit  = 1 << 6
+	rsv2Bit  = 1 << 5
+	rsv3Bit  = 1 << 4
+	maskBit  = 1 << 7
+
+	maxControlPayload = 125
+)
+
+var (
+	// ErrCloseSent is returned by the writes after a close message.
+	ErrCloseSent = errors.New("websocket: close sent")
+	// ErrReadLimit is returned when a message is larger than the read limit.
+	ErrReadLimit = errors.New("websocket: read limit exceeded")
+)
+
+// CloseError is returned by ReadMessage when the peer closes the connection.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return "websocket: close " + strconv.Itoa(e.Code) + " " + e.Text
+}
+
+// IsCloseError reports whether err is a CloseError with one of the codes.
+func IsCloseError(err error, codes ...int) bool {
+	var ce *CloseError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	for _, code := range codes {
+		if ce.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatCloseMessage returns the payload of a close message.
+func FormatCloseMessage(code int, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return []byte{}
+	}
+	buf := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(buf, uint16(code))
+	copy(buf[2:], text)
+	return buf
+}
+
+// Conn is a WebSocket connection.
+//
+// A connection has one reader at a time, ReadMessage also handles the
+// control messages of the peer. The writes are safe for concurrent use,
+// the control messages are sent between the frames of a fragmented message.
+type Conn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	isServer    bool
+	subprotocol string
+	compression bool // permessage-deflate negotiated
+	compress    bool // compress the written messages
+	frameSize   int
+	readLimit   int64
+
+	// msgMu serializes the data messages, wmu the frames.
+	msgMu         sync.Mutex
+	wmu           sync.Mutex
+	writeDeadline time.Time
+	closeSent     bool
+
+	readErr     error
+	handlePing  func(appData string) error
+	handlePong  func(appData string) error
+	handleClose func(code int, text string) error
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, isServer bool, o *options) *Conn {
+	if br == nil {
+		br = bufio.NewReaderSize(conn, o.readBufferSize)
+	}
+	c := &Conn{
+		conn:      conn,
+		br:        br,
+		isServer:  isServer,
+		frameSize: o.writeBufferSize,
+		readLimit: o.readLimit,
+	}
+	c.SetPingHandler(nil)
+	c.SetPongHandler(nil)
+	c.SetCloseHandler(nil)
+	return c
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// Close closes the underlying connection without a close handshake, see
+// WriteClose.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// SetReadDeadline sets the deadline of the reads, a timed out read fails
+// the connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of the data messages.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+// SetReadLimit sets the maximum size of a message, after decompression. A
+// larger message fails the connection with CloseMessageTooBig.
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// EnableWriteCompression enables the compression of the written messages,
+// it has no effect if permessage-deflate was not negotiated.
+func (c *Conn) EnableWriteCompression(enable bool) {
+	c.msgMu.Lock()
+	defer c.msgMu.Unlock()
+	c.compress = enable && c.compression
+}
+
+// SetPingHandler sets the handler of the ping messages, the default
+// handler answers a pong message.
+func (c *Conn) SetPingHandler(h func(appData string) error) {
+	if h == nil {
+		h = func(appData string) error {
+			err := c.WriteControl(PongMessage, []byte(appData), time.Now().Add(time.Second))
+			if errors.Is(err, ErrCloseSent) {
+				return nil
+			}
+			return err
+		}
+	}
+	c.handlePing = h
+}
+
+// SetPongHandler sets the handler of the pong messages, by default they
+// are ignored.
+func (c *Conn) SetPongHandler(h func(appData string) error) {
+	if h == nil {
+		h = func(string) error { return nil }
+	}
+	c.handlePong = h
+}
+
+// SetCloseHandler sets the handler of the close message of the peer, the
+// default handler answers a close message with the same code.
+func (c *Conn) SetCloseHandler(h func(code int, text string) error) {
+	if h == nil {
+		h = func(code int, _ string) error {
+			err := c.WriteControl(CloseMessage, FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+			if errors.Is(err, ErrCloseSent) {
+				return nil
+			}
+			return err
+		}
+	}
+	c.handleClose = h
+}
+
+// WriteClose starts the close handshake, the connection is closed once
+// ReadMessage returns the CloseError of the answer.
+func (c *Conn) WriteClose(code int, text string) error {
+	return c.WriteControl(CloseMessage, FormatCloseMessage(code, text), time.Now().Add(time.Second))
+}
+
+// WriteControl writes a ping, pong or close message, the payload is at most
+// 125 bytes. Nothing can be written after a close message.
+func (c *Conn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if messageType != CloseMessage && messageType != PingMessage && messageType != PongMessage {
+		return fmt.Errorf("websocket: bad control message type %d", messageType)
+	}
+	if len(data) > maxControlPayload {
+		return errors.New("websocket: control message too long")
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if messageType == CloseMessage {
+		c.closeSent = true
+	}
+	return c.writeFrame(finalBit|byte(messageType), data, deadline)
+}
+
+// WriteMessage writes a text or binary message, a message larger than the
+// write buffer is fragmented.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket: bad data message type %d", messageType)
+	}
+
+	c.msgMu.Lock()
+	defer c.msgMu.Unlock()
+
+	b0 := byte(messageType)
+	if c.compress {
+		var err error
+		if data, err = compressMessage(data); err != nil {
+			return err
+		}
+		b0 |= rsv1Bit
+	}
+
+	for {
+		n := len(data)
+		if n > c.frameSize {
+			n = c.frameSize
+		}
+		final := n == len(data)
+		if final {
+			b0 |= finalBit
+		}
+
+		c.wmu.Lock()
+		err := ErrCloseSent
+		if !c.closeSent {
+			err = c.writeFrame(b0, data[:n], c.writeDeadline)
+		}
+		c.wmu.Unlock()
+		if err != nil || final {
+			return err
+		}
+		data = data[n:]
+		b0 = continuationFrame
+	}
+}
+
+// writeFrame writes a frame, the caller holds wmu.
+func (c *Conn) writeFrame(b0 byte, payload []byte, deadline time.Time) error {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, b0)
+
+	var b1 byte
+	if !c.isServer {
+		b1 = maskBit
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, b1|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, b1|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(frame, b1|127)
+		frame = append(frame, ext[:]...)
+	}
+
+	if c.isServer {
+		frame = append(frame, payload...)
+	} else {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		frame = append(frame, key[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(key, frame[start:])
+	}
+
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// ReadMessage reads the next text or binary message, the fragments are
+// reassembled and the control messages are handled in between. It returns
+// a CloseError once the peer closed the connection, the caller then closes
+// it. A message that violates the protocol fails the connection. A read
+// error is final.
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	messageType, p, err = c.readMessage()
+	if err != nil {
+		c.readErr = err
+	}
+	return messageType, p, err
+}
+
+func (c *Conn) readMessage() (int, []byte, error) {
+	var (
+		messageType int
+		compressed  bool
+		message     []byte
+	)
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case PingMessage:
+			if err := c.handlePing(string(f.payload)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if err := c.handlePong(string(f.payload)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, c.readClose(f.payload)
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, protocolError("unexpected continuation frame"))
+			}
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, protocolError("message start before final frame"))
+			}
+			messageType = int(f.opcode)
+			compressed = f.rsv1
+		}
+
+		if c.readLimit > 0 && int64(len(message))+int64(len(f.payload)) > c.readLimit {
+			return 0, nil, c.fail(CloseMessageTooBig, ErrReadLimit)
+		}
+		message = append(message, f.payload...)
+		if !f.final {
+			continue
+		}
+
+		if compressed {
+			if message, err = decompressMessage(message, c.readLimit); err != nil {
+				if errors.Is(err, ErrReadLimit) {
+					return 0, nil, c.fail(CloseMessageTooBig, err)
+				}
+				return 0, nil, c.fail(CloseInvalidFramePayloadData, err)
+			}
+		}
+		if messageType == TextMessage && !utf8.Valid(message) {
+			return 0, nil, c.fail(CloseInvalidFramePayloadData, protocolError("invalid utf8 payload"))
+		}
+		if message == nil {
+			message = []byte{}
+		}
+		return messageType, message, nil
+	}
+}
+
+// readClose handles the close message of the peer.
+func (c *Conn) readClose(payload []byte) error {
+	code, text := CloseNoStatusReceived, ""
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, protocolError("invalid close payload"))
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		text = string(payload[2:])
+		if !validCloseCode(code) {
+			return c.fail(CloseProtocolError, protocolError("invalid close code "+strconv.Itoa(code)))
+		}
+		if !utf8.ValidString(text) {
+			return c.fail(CloseInvalidFramePayloadData, protocolError("invalid utf8 close reason"))
+		}
+	}
+	if err := c.handleClose(code, text); err != nil {
+		return err
+	}
+	return &CloseError{Code: code, Text: text}
+}
+
+type frame struct {
+	final   bool
+	rsv1    bool
+	opcode  byte
+	payload []byte
+}
+
+func (c *Conn) readFrame() (frame, error) {
+	var f frame
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return f, err
+	}
+
+	f.final = head[0]&finalBit != 0
+	f.rsv1 = head[0]&rsv1Bit != 0
+	f.opcode = head[0] & 0x0f
+	masked := head[1]&maskBit != 0
+	length := int64(head[1] & 0x7f)
+
+	switch f.opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+		if f.rsv1 && (!c.compression || f.opcode == continuationFrame) {
+			return f, c.fail(CloseProtocolError, protocolError("unexpected rsv1 bit"))
+		}
+	case CloseMessage, PingMessage, PongMessage:
+		if !f.final || length > maxControlPayload || f.rsv1 {
+			return f, c.fail(CloseProtocolError, protocolError("invalid control frame"))
+		}
+	default:
+		return f, c.fail(CloseProtocolError, protocolError("unknown opcode "+strconv.Itoa(int(f.opcode))))
+	}
+	if head[0]&(rsv2Bit|rsv3Bit) != 0 {
+		return f, c.fail(CloseProtocolError, protocolError("unexpected rsv bits"))
+	}
+	if masked != c.isServer {
+		return f, c.fail(CloseProtocolError, protocolError("bad frame masking"))
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return f, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return f, err
+		}
+		if ext[0]&0x80 != 0 {
+			return f, c.fail(CloseProtocolError, protocolError("invalid payload length"))
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if c.readLimit > 0 && length > c.readLimit {
+		return f, c.fail(CloseMessageTooBig, ErrReadLimit)
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return f, err
+		}
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return f, err
+	}
+	if masked {
+		maskBytes(key, f.payload)
+	}
+	return f, nil
+}
+
+// fail fails the connection: a close message with the code is sent and the
+// connection is closed.
+func (c *Conn) fail(code int, err error) error {
+	_ = c.WriteControl(CloseMessage, FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+	_ = c.conn.Close()
+	return err
+}
+
+// protocolError is a violation of the protocol by the peer.
+func protocolError(text string) error {
+	return errors.New("websocket: " + text)
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
+
+// validCloseCode reports whether a close code can be sent in a close message.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
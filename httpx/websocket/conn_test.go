@@ -0,0 +1,239 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// echoServer upgrades the requests and echoes the messages until an error.
+func echoServer(t *testing.T, opts ...Option) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r, opts...)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			mt, p, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(mt, p); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// handshake sends an opening handshake and returns the response.
+func handshake(t *testing.T, srv *httptest.Server, header http.Header) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	assert.Nil(t, req.Write(conn))
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	return conn, br, resp
+}
+
+// dial opens a client connection to a server.
+func dial(t *testing.T, srv *httptest.Server, header http.Header) (*Conn, *http.Response) {
+	conn, br, resp := handshake(t, srv, header)
+	if !assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode) {
+		t.FailNow()
+	}
+	c := newConn(conn, br, false, newOptions(nil))
+	c.compression = strings.HasPrefix(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	c.compress = c.compression
+	return c, resp
+}
+
+func TestUpgrade(t *testing.T) {
+	bad := []struct {
+		method string
+		header map[string]string
+		code   int
+	}{
+		{http.MethodPost, nil, http.StatusMethodNotAllowed},
+		{http.MethodGet, map[string]string{"Connection": "keep-alive"}, http.StatusBadRequest},
+		{http.MethodGet, map[string]string{"Sec-WebSocket-Version": "8"}, http.StatusUpgradeRequired},
+		{http.MethodGet, map[string]string{"Sec-WebSocket-Key": "c2hvcnQ="}, http.StatusBadRequest},
+		{http.MethodGet, map[string]string{"Origin": "http://evil.com"}, http.StatusForbidden},
+	}
+	for _, tc := range bad {
+		r := httptest.NewRequest(tc.method, "http://example.com/ws", nil)
+		r.Header.Set("Connection", "keep-alive, Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		r.Header.Set("Origin", "http://example.com")
+		for k, v := range tc.header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		_, err := Upgrade(w, r)
+		assert.IsType(t, HandshakeError{}, err)
+		assert.Equal(t, tc.code, w.Code, tc.header)
+	}
+
+	srv := echoServer(t, WithSubprotocols("v2", "v1"), WithResponseHeader(http.Header{"X-Server": {"echo"}}))
+	_, resp := dial(t, srv, http.Header{"Sec-Websocket-Protocol": {"v1, v2"}})
+	// RFC 6455 section 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	assert.Equal(t, "v2", resp.Header.Get("Sec-WebSocket-Protocol"))
+	assert.Equal(t, "echo", resp.Header.Get("X-Server"))
+	assert.Empty(t, resp.Header.Get("Sec-WebSocket-Extensions"))
+}
+
+func TestConn_Echo(t *testing.T) {
+	srv := echoServer(t, WithBufferSize(0, 16))
+	c, _ := dial(t, srv, nil)
+
+	assert.Nil(t, c.WriteMessage(TextMessage, []byte("hello")))
+	mt, p, err := c.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, TextMessage, mt)
+	assert.Equal(t, "hello", string(p))
+
+	// the server fragments the answer into 16 bytes frames
+	large := bytes.Repeat([]byte("0123456789"), 100)
+	c.frameSize = 100
+	assert.Nil(t, c.WriteMessage(BinaryMessage, large))
+	mt, p, err = c.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, BinaryMessage, mt)
+	assert.Equal(t, large, p)
+
+	// a pong answers a ping between the messages
+	var pong string
+	c.SetPongHandler(func(appData string) error {
+		pong = appData
+		return nil
+	})
+	assert.Nil(t, c.WriteControl(PingMessage, []byte("p1"), time.Now().Add(time.Second)))
+	assert.Nil(t, c.WriteMessage(TextMessage, []byte("after")))
+	_, p, err = c.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "after", string(p))
+	assert.Equal(t, "p1", pong)
+
+	// the server answers the close message
+	assert.Nil(t, c.WriteClose(CloseNormalClosure, "bye"))
+	assert.Equal(t, ErrCloseSent, c.WriteMessage(TextMessage, []byte("late")))
+	_, _, err = c.ReadMessage()
+	assert.True(t, IsCloseError(err, CloseNormalClosure), err)
+	_, _, err2 := c.ReadMessage()
+	assert.Equal(t, err, err2)
+}
+
+func TestConn_Compression(t *testing.T) {
+	srv := echoServer(t, WithCompression(true), WithBufferSize(0, 64))
+	c, resp := dial(t, srv, http.Header{"Sec-Websocket-Extensions": {"x-unknown, permessage-deflate; server_max_window_bits=10, permessage-deflate; client_max_window_bits"}})
+	assert.Equal(t, "permessage-deflate; server_no_context_takeover; client_no_context_takeover", resp.Header.Get("Sec-WebSocket-Extensions"))
+
+	msg := strings.Repeat("compress me ", 1000)
+	for i := 0; i < 3; i++ {
+		c.EnableWriteCompression(i != 1)
+		assert.Nil(t, c.WriteMessage(TextMessage, []byte(msg)))
+		_, p, err := c.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, msg, string(p))
+	}
+
+	// the server does not compress without the extension
+	c, resp = dial(t, srv, http.Header{"Sec-Websocket-Extensions": {"permessage-deflate; server_max_window_bits=10"}})
+	assert.Empty(t, resp.Header.Get("Sec-WebSocket-Extensions"))
+	assert.Nil(t, c.WriteMessage(TextMessage, []byte(msg)))
+	_, p, err := c.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, msg, string(p))
+}
+
+// rawFrame encodes a raw client frame.
+func rawFrame(b0 byte, payload []byte, masked bool) []byte {
+	b1 := byte(0)
+	if masked {
+		b1 = maskBit
+	}
+	out := []byte{b0}
+	if len(payload) < 126 {
+		out = append(out, b1|byte(len(payload)))
+	} else {
+		out = append(out, b1|126, 0, 0)
+		binary.BigEndian.PutUint16(out[2:], uint16(len(payload)))
+	}
+	if masked {
+		key := [4]byte{1, 2, 3, 4}
+		out = append(out, key[:]...)
+		start := len(out)
+		out = append(out, payload...)
+		maskBytes(key, out[start:])
+		return out
+	}
+	return append(out, payload...)
+}
+
+func TestConn_ProtocolErrors(t *testing.T) {
+	srv := echoServer(t, WithReadLimit(100))
+	cases := []struct {
+		name  string
+		frame []byte
+		code  int
+	}{
+		{"unmasked", rawFrame(finalBit|TextMessage, []byte("x"), false), CloseProtocolError},
+		{"invalid utf8", rawFrame(finalBit|TextMessage, []byte{0xff, 0xfe}, true), CloseInvalidFramePayloadData},
+		{"too big", rawFrame(finalBit|BinaryMessage, make([]byte, 101), true), CloseMessageTooBig},
+		{"continuation", rawFrame(finalBit|continuationFrame, []byte("x"), true), CloseProtocolError},
+		{"fragmented ping", rawFrame(PingMessage, nil, true), CloseProtocolError},
+		{"reserved opcode", rawFrame(finalBit|3, nil, true), CloseProtocolError},
+		{"rsv1 without extension", rawFrame(finalBit|rsv1Bit|TextMessage, []byte("x"), true), CloseProtocolError},
+		{"bad close code", rawFrame(finalBit|CloseMessage, []byte{0x03, 0xed}, true), CloseProtocolError},
+		{"interleaved message", append(rawFrame(TextMessage, []byte("a"), true), rawFrame(finalBit|TextMessage, []byte("b"), true)...), CloseProtocolError},
+	}
+	for _, tc := range cases {
+		conn, br, resp := handshake(t, srv, nil)
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		_, err := conn.Write(tc.frame)
+		assert.Nil(t, err)
+
+		c := newConn(conn, br, false, newOptions(nil))
+		c.SetCloseHandler(func(int, string) error { return nil })
+		_, _, err = c.ReadMessage()
+		assert.True(t, IsCloseError(err, tc.code), "%s: %v", tc.name, err)
+	}
+
+	// the fragments of a text message are valid utf8 once reassembled
+	conn, br, _ := handshake(t, srv, nil)
+	euro := []byte("€")
+	_, err := conn.Write(append(rawFrame(TextMessage, euro[:1], true), rawFrame(finalBit|continuationFrame, euro[1:], true)...))
+	assert.Nil(t, err)
+	_, p, err := newConn(conn, br, false, newOptions(nil)).ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "€", string(p))
+}
@@ -0,0 +1,240 @@
+// Package websocket implements the WebSocket protocol, RFC 6455, with the
+// permessage-deflate extension, RFC 7692, on the server side of httpx.
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBufferSize = 4096
+	defaultReadLimit  = 16 << 20
+
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// HandshakeError is a failed opening handshake, it has been answered with
+// an HTTP error.
+type HandshakeError struct {
+	message string
+}
+
+func (e HandshakeError) Error() string {
+	return "websocket: " + e.message
+}
+
+type options struct {
+	subprotocols    []string
+	checkOrigin     func(r *http.Request) bool
+	compression     bool
+	readLimit       int64
+	readBufferSize  int
+	writeBufferSize int
+	header          http.Header
+}
+
+type Option func(o *options)
+
+// WithSubprotocols sets the subprotocols of the server by preference, the
+// first one the client offers is selected.
+func WithSubprotocols(protocols ...string) Option {
+	return func(o *options) {
+		o.subprotocols = protocols
+	}
+}
+
+// WithCheckOrigin sets the check of the Origin header, by default the
+// origin must be the host of the request.
+func WithCheckOrigin(fn func(r *http.Request) bool) Option {
+	return func(o *options) {
+		o.checkOrigin = fn
+	}
+}
+
+// WithCompression negotiates permessage-deflate if the client offers it,
+// the written messages are then compressed.
+func WithCompression(enable bool) Option {
+	return func(o *options) {
+		o.compression = enable
+	}
+}
+
+// WithReadLimit sets the maximum size of a message, 16MB by default.
+func WithReadLimit(limit int64) Option {
+	return func(o *options) {
+		o.readLimit = limit
+	}
+}
+
+// WithBufferSize sets the size of the read buffer and the size of the
+// written frames, the larger messages are fragmented.
+func WithBufferSize(read, write int) Option {
+	return func(o *options) {
+		if read > 0 {
+			o.readBufferSize = read
+		}
+		if write > 0 {
+			o.writeBufferSize = write
+		}
+	}
+}
+
+// WithResponseHeader adds header fields to the handshake response, e.g. Set-Cookie.
+func WithResponseHeader(header http.Header) Option {
+	return func(o *options) {
+		o.header = header
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		checkOrigin:     sameOrigin,
+		readLimit:       defaultReadLimit,
+		readBufferSize:  defaultBufferSize,
+		writeBufferSize: defaultBufferSize,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Upgrade answers the opening handshake of a request and returns the
+// connection. A bad handshake is answered with an HTTP error and a
+// HandshakeError is returned. The deadlines of the server are removed from
+// the connection.
+func Upgrade(w http.ResponseWriter, r *http.Request, opts ...Option) (*Conn, error) {
+	o := newOptions(opts)
+
+	if r.Method != http.MethodGet {
+		return nil, handshakeError(w, http.StatusMethodNotAllowed, "request method is not GET")
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") {
+		return nil, handshakeError(w, http.StatusBadRequest, "'upgrade' token not found in 'Connection' header")
+	}
+	if !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, handshakeError(w, http.StatusBadRequest, "'websocket' token not found in 'Upgrade' header")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-Websocket-Version", "13")
+		return nil, handshakeError(w, http.StatusUpgradeRequired, "unsupported version")
+	}
+	key := r.Header.Get("Sec-Websocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, handshakeError(w, http.StatusBadRequest, "invalid 'Sec-WebSocket-Key' header")
+	}
+	if !o.checkOrigin(r) {
+		return nil, handshakeError(w, http.StatusForbidden, "request origin not allowed")
+	}
+
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, handshakeError(w, http.StatusInternalServerError, "response does not implement http.Hijacker")
+	}
+
+	subprotocol := selectSubprotocol(r.Header, o.subprotocols)
+	compression := o.compression && negotiateDeflate(r.Header.Values("Sec-Websocket-Extensions"))
+
+	netConn, brw, err := h.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	if brw.Reader.Buffered() > 0 {
+		netConn.Close()
+		return nil, errors.New("websocket: client sent data before handshake")
+	}
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	b.WriteString(acceptKey(key))
+	b.WriteString("\r\n")
+	if subprotocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	if compression {
+		b.WriteString("Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n")
+	}
+	for name, values := range o.header {
+		if strings.EqualFold(name, "Sec-Websocket-Protocol") || strings.EqualFold(name, "Sec-Websocket-Extensions") {
+			continue
+		}
+		for _, v := range values {
+			b.WriteString(name + ": " + strings.NewReplacer("\r", "", "\n", "").Replace(v) + "\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+
+	// the server deadlines are set on the connection of the request
+	if err := netConn.SetDeadline(time.Time{}); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if _, err := netConn.Write([]byte(b.String())); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	c := newConn(netConn, brw.Reader, true, o)
+	c.subprotocol = subprotocol
+	c.compression = compression
+	c.compress = compression
+	return c, nil
+}
+
+func handshakeError(w http.ResponseWriter, code int, message string) error {
+	err := HandshakeError{message: message}
+	http.Error(w, http.StatusText(code), code)
+	return err
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key))
+	h.Write([]byte(acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// sameOrigin reports whether the request has no Origin header or its host
+// is the host of the request.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// headerContains reports whether a comma separated header has a token.
+func headerContains(header http.Header, name, token string) bool {
+	for _, v := range header.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func selectSubprotocol(header http.Header, protocols []string) string {
+	for _, p := range protocols {
+		for _, v := range header.Values("Sec-Websocket-Protocol") {
+			for _, offer := range strings.Split(v, ",") {
+				if strings.TrimSpace(offer) == p {
+					return p
+				}
+			}
+		}
+	}
+	return ""
+}
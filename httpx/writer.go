@@ -14,11 +14,19 @@ const (
 )
 
 const (
-	HeaderContentType               = "Content-type"
-	HeaderSetCookie                 = "Set-Cookie"
-	HeaderAccessControlAllowOrigin  = "Access-Control-Allow-Origin"
-	HeaderAccessControlAllowMethods = "Access-Control-Allow-Methods"
-	HeaderAccessControlAllowHeaders = "Access-Control-Allow-Headers"
+	HeaderContentType                   = "Content-type"
+	HeaderSetCookie                     = "Set-Cookie"
+	HeaderAllow                         = "Allow"
+	HeaderOrigin                        = "Origin"
+	HeaderVary                          = "Vary"
+	HeaderAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	HeaderAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	HeaderAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	HeaderAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	HeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
+	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
+	HeaderAccessControlRequestHeaders   = "Access-Control-Request-Headers"
 
 	ContentTypeTextPlain           = "text/plain"
 	ContentTypeTextHtml            = "text/html"
@@ -0,0 +1,188 @@
+// Copyright (c) 2013 Ben Johnson. All rights reserved.
+// Parts of this file are derived from bbolt, https://github.com/etcd-io/bbolt,
+// use of this source code is governed by a MIT style license that can be
+// found in the LICENSE.bbolt file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"unsafe"
+)
+
+// WriteTo writes the entire database to a writer.
+// The copy is the version of the database this transaction sees, so it is
+// consistent while other transactions keep writing. A writable transaction
+// writes the version it started with, its own changes are not included.
+//
+// The pages are read from the data file, they are not freed by other
+// transactions while this transaction is open.
+func (tx *Tx) WriteTo(w io.Writer) (n int64, err error) {
+	if tx.db == nil {
+		return 0, ErrTxClosed
+	}
+
+	// Generate a meta page. We use the same page data for both meta pages,
+	// a writable transaction uses the last committed meta.
+	m := tx.snapshotMeta()
+
+	buf := make([]byte, tx.db.pageSize)
+	p := pageInBuffer(buf, tx.db.pageSize, 0)
+	p.flags = metaPageFlag
+
+	// Write meta 0 and meta 1, meta 1 with a lower transaction id so meta 0
+	// is the current version of the copy.
+	for id := pgid(0); id <= 1; id++ {
+		mc := m
+		mc.txid -= txid(id)
+		mc.checksum = mc.sum64()
+		*p.meta() = mc
+		p.id = id
+
+		written, err := w.Write(buf)
+		n += int64(written)
+		if err != nil {
+			return n, fmt.Errorf("meta %d copy: %w", id, err)
+		}
+	}
+
+	// Pages of the write-ahead log are not in the data file yet.
+	ids := make(pgids, 0, len(tx.walPages))
+	for id := range tx.walPages {
+		if id >= 2 && id < m.pgid {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(ids)
+
+	// Copy data pages using a section reader of the data file, the file is
+	// safe for concurrent ReadAt calls.
+	next := pgid(2)
+	for _, id := range ids {
+		written, err := tx.copyPages(w, next, id)
+		n += written
+		if err != nil {
+			return n, err
+		}
+
+		p := tx.walPages[id]
+		buf := unsafe.Slice((*byte)(unsafe.Pointer(p)), (int(p.overflow)+1)*tx.db.pageSize)
+		nw, err := w.Write(buf)
+		n += int64(nw)
+		if err != nil {
+			return n, err
+		}
+		next = id + pgid(p.overflow) + 1
+	}
+	written, err := tx.copyPages(w, next, m.pgid)
+	n += written
+	return n, err
+}
+
+// copyPages copies the pages [from, to) of the data file, the pages past the
+// end of the file (free pages of a write-ahead log version) are zero filled.
+func (tx *Tx) copyPages(w io.Writer, from, to pgid) (int64, error) {
+	if from >= to {
+		return 0, nil
+	}
+
+	offset := int64(from) * int64(tx.db.pageSize)
+	size := int64(to-from) * int64(tx.db.pageSize)
+	n, err := io.Copy(w, io.NewSectionReader(tx.db.file, offset, size))
+	if err != nil {
+		return n, err
+	}
+	if n < size {
+		written, err := io.CopyN(w, zeroReader{}, size-n)
+		n += written
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// zeroReader reads zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// snapshotMeta returns the meta of the version written by WriteTo.
+func (tx *Tx) snapshotMeta() meta {
+	if tx.writable {
+		return *tx.db.meta()
+	}
+	return *tx.meta
+}
+
+// snapshotSize returns the size in bytes of the version written by WriteTo.
+func (tx *Tx) snapshotSize() int64 {
+	m := tx.snapshotMeta()
+	return int64(m.pgid) * int64(tx.db.pageSize)
+}
+
+// CopyFile copies the entire database to file at the given path.
+// A reader transaction is maintained during the copy so it is safe to
+// continue using the database while a copy is in progress.
+func (tx *Tx) CopyFile(path string, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.WriteTo(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// BackupHandler returns a handler that streams a consistent snapshot of the
+// database as the response body. It is mounted on a httpx.Router with
+// httpx.WrapH, which lifts the timeout so the snapshot is not buffered:
+//
+//	router.GET("/debug/singledb/backup", httpx.WrapH(singledb.BackupHandler(db)))
+//
+// The snapshot does not hold the mmap, writes continue while it is streamed,
+// even the ones growing the database. Its pages are kept until the response
+// is written, a slow client holds back the reuse of the pages freed since.
+func BackupHandler(db *DB) http.Handler {
+	name := filepath.Base(db.Path())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx, err := db.beginSnapshot()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.rollback()
+
+		header := w.Header()
+		header.Set("Content-Type", "application/octet-stream")
+		header.Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		header.Set("Content-Length", strconv.FormatInt(tx.snapshotSize(), 10))
+		// Nothing can be done once the body is being written, the client
+		// sees a short response.
+		if n, err := tx.WriteTo(w); err != nil && n == 0 {
+			header.Del("Content-Length")
+			header.Del("Content-Disposition")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pkgx/httpx"
+)
+
+func TestTx_WriteTo(t *testing.T) {
+	db, err := Open(tempPath(t), WithInitialMmapSize(1<<20))
+	assert.Nil(t, err)
+	defer db.Close()
+	putN(t, db, 0, 500, false)
+
+	tx, err := db.Begin(false)
+	assert.Nil(t, err)
+
+	// writes after the snapshot started are not part of it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Nil(t, db.Update(func(tx *Tx) error {
+			return tx.DeleteBucket([]byte("widgets"))
+		}))
+	}()
+	<-done
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	assert.Nil(t, tx.CopyFile(path, 0600))
+	assert.Nil(t, tx.Rollback())
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Zero(t, info.Size()%int64(db.pageSize))
+
+	backup, err := Open(path, WithReadOnly(true))
+	assert.Nil(t, err)
+	defer backup.Close()
+	assert.Nil(t, backup.View(func(tx *Tx) error {
+		for err := range tx.Check() {
+			t.Error(err)
+		}
+		assert.Equal(t, 500, tx.Bucket([]byte("widgets")).Stats().KeyN)
+		return nil
+	}))
+}
+
+func TestBackupHandler(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+	putN(t, db, 0, 100, false)
+
+	srv := httpx.New()
+	srv.Handle().GET("/backup", httpx.WrapH(BackupHandler(db)))
+
+	rec := httptest.NewRecorder()
+	srv.Handle().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/backup", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, httpx.ContentTypeApplicationStream, rec.Header().Get(httpx.HeaderContentType))
+	assert.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get("Content-Length"))
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	assert.Nil(t, os.WriteFile(path, rec.Body.Bytes(), 0600))
+	backup, err := Open(path, WithReadOnly(true))
+	assert.Nil(t, err)
+	defer backup.Close()
+	assert.Nil(t, backup.View(func(tx *Tx) error {
+		assert.Equal(t, 100, tx.Bucket([]byte("widgets")).Stats().KeyN)
+		return nil
+	}))
+
+	var buf bytes.Buffer
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		_, err := tx.WriteTo(&buf)
+		return err
+	}))
+	assert.Equal(t, buf.Bytes(), rec.Body.Bytes())
+}
+
+// stalledWriter is a response writer whose client stops reading after the
+// first write.
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	if w.started != nil {
+		close(w.started)
+		w.started = nil
+		<-w.release
+	}
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestBackupHandler_StalledClient(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+	putN(t, db, 0, 100, false)
+
+	w := &stalledWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		started:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	started := w.started
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		BackupHandler(db).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/backup", nil))
+	}()
+	<-started
+
+	// a write remapping the database is not blocked by the client
+	updated := make(chan struct{})
+	go func() {
+		defer close(updated)
+		putN(t, db, 0, 20000, false)
+	}()
+	select {
+	case <-updated:
+	case <-time.After(5 * time.Second):
+		t.Error("write blocked by the backup")
+	}
+	close(w.release)
+	<-served
+	<-updated
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	assert.Nil(t, os.WriteFile(path, w.Body.Bytes(), 0600))
+	backup, err := Open(path, WithReadOnly(true))
+	assert.Nil(t, err)
+	defer backup.Close()
+	assert.Nil(t, backup.View(func(tx *Tx) error {
+		for err := range tx.Check() {
+			t.Error(err)
+		}
+		assert.Equal(t, 100, tx.Bucket([]byte("widgets")).Stats().KeyN)
+		return nil
+	}))
+}
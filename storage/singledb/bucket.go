@@ -0,0 +1,658 @@
+// Copyright (c) 2013 Ben Johnson. All rights reserved.
+// Parts of this file are derived from bbolt, https://github.com/etcd-io/bbolt,
+// use of this source code is governed by a MIT style license that can be
+// found in the LICENSE.bbolt file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// MaxKeySize is the maximum length of a key, in bytes.
+	MaxKeySize = 32768
+
+	// MaxValueSize is the maximum length of a value, in bytes.
+	MaxValueSize = (1 << 31) - 2
+)
+
+// bucketLeafFlag marks a leaf element whose value is a bucket header.
+const bucketLeafFlag = 0x01
+
+// bucketHeaderSize is the size of a bucket header stored as a leaf value.
+const bucketHeaderSize = 16
+
+// Record is a key/value pair returned by Range, like bplustree.Record.
+type Record struct {
+	Key   []byte
+	Value []byte
+}
+
+// bucket represents the on-file representation of a bucket.
+// This is stored as the "value" of a bucket key.
+type bucket struct {
+	root     pgid   // page id of the bucket's root-level page
+	sequence uint64 // monotonically incrementing, used by NextSequence()
+}
+
+// encode returns the on-file bytes of the bucket header.
+func (b *bucket) encode() []byte {
+	value := make([]byte, bucketHeaderSize)
+	binary.LittleEndian.PutUint64(value[0:], uint64(b.root))
+	binary.LittleEndian.PutUint64(value[8:], b.sequence)
+	return value
+}
+
+// decode reads the bucket header from its on-file bytes.
+func (b *bucket) decode(value []byte) {
+	b.root = pgid(binary.LittleEndian.Uint64(value[0:]))
+	b.sequence = binary.LittleEndian.Uint64(value[8:])
+}
+
+// Bucket represents a collection of key/value pairs inside the database,
+// it is the on-disk counterpart of bplustree.BPlusTree.
+// Keys are ordered by bytes.Compare, pages are read from the mmap and only
+// materialized into nodes when they are changed by a write transaction.
+// A bucket may contain nested buckets, they share the key space of their parent.
+type Bucket struct {
+	*bucket
+	tx       *Tx                // the associated transaction
+	buckets  map[string]*Bucket // subbucket cache
+	rootNode *node              // materialized node for the root page.
+	nodes    map[pgid]*node     // node cache
+	name     []byte             // name of a top-level bucket, nil for nested and internal ones
+}
+
+// newBucket returns a new bucket associated with a transaction.
+func newBucket(tx *Tx) Bucket {
+	b := Bucket{tx: tx}
+	if tx.writable {
+		b.buckets = make(map[string]*Bucket)
+		b.nodes = make(map[pgid]*node)
+	}
+	return b
+}
+
+// Tx returns the tx of the bucket.
+func (b *Bucket) Tx() *Tx {
+	return b.tx
+}
+
+// Root returns the root of the bucket.
+func (b *Bucket) Root() uint64 {
+	return uint64(b.root)
+}
+
+// Writable returns whether the bucket is writable.
+func (b *Bucket) Writable() bool {
+	return b.tx.writable
+}
+
+// Cursor creates a cursor associated with the bucket.
+// The cursor is only valid as long as the transaction is open.
+func (b *Bucket) Cursor() *Cursor {
+	return &Cursor{
+		bucket: b,
+		stack:  make([]elemRef, 0),
+	}
+}
+
+// Bucket retrieves a nested bucket by name.
+// Returns nil if the bucket does not exist.
+func (b *Bucket) Bucket(name []byte) *Bucket {
+	if b.buckets != nil {
+		if child := b.buckets[string(name)]; child != nil {
+			return child
+		}
+	}
+
+	// Move cursor to key.
+	c := b.Cursor()
+	k, v, flags := c.seek(name)
+
+	// Return nil if the key doesn't exist or it is not a bucket.
+	if !bytes.Equal(name, k) || (flags&bucketLeafFlag) == 0 {
+		return nil
+	}
+
+	// Otherwise create a bucket and cache it.
+	child := b.openBucket(v)
+	child.name = b.childName(name)
+	if b.buckets != nil {
+		b.buckets[string(name)] = child
+	}
+	return child
+}
+
+// openBucket reopens a nested bucket from its header value.
+func (b *Bucket) openBucket(value []byte) *Bucket {
+	child := newBucket(b.tx)
+	child.bucket = &bucket{}
+	if len(value) == bucketHeaderSize {
+		child.bucket.decode(value)
+	}
+	return &child
+}
+
+// childName returns the name a child bucket keeps, only top-level buckets are
+// named since indexes and ttls are declared on them.
+func (b *Bucket) childName(name []byte) []byte {
+	if b != &b.tx.root || isReserved(name) {
+		return nil
+	}
+	return cloneBytes(name)
+}
+
+// CreateBucket creates a new nested bucket at the given key and returns it.
+// Returns an error if the key already exists, if the bucket name is blank,
+// or if the bucket name is too long.
+func (b *Bucket) CreateBucket(key []byte) (*Bucket, error) {
+	if b.tx.db == nil {
+		return nil, ErrTxClosed
+	} else if !b.tx.writable {
+		return nil, ErrTxNotWritable
+	} else if len(key) == 0 {
+		return nil, ErrBucketNameRequired
+	} else if len(key) > MaxKeySize {
+		return nil, ErrKeyTooLarge
+	}
+
+	// Move cursor to correct position.
+	c := b.Cursor()
+	k, _, flags := c.seek(key)
+
+	// Return an error if there is an existing key.
+	if bytes.Equal(key, k) {
+		if (flags & bucketLeafFlag) != 0 {
+			return nil, ErrBucketExists
+		}
+		return nil, ErrIncompatibleValue
+	}
+
+	// A new bucket starts with an empty leaf root node that has no page yet,
+	// the page is allocated when the bucket is spilled.
+	child := newBucket(b.tx)
+	child.bucket = &bucket{}
+	child.rootNode = &node{bucket: &child, isLeaf: true}
+	child.name = b.childName(key)
+
+	key = cloneBytes(key)
+	c.node().put(key, key, child.bucket.encode(), 0, bucketLeafFlag)
+	b.buckets[string(key)] = &child
+
+	return &child, nil
+}
+
+// CreateBucketIfNotExists creates a new bucket if it doesn't already exist and returns it.
+func (b *Bucket) CreateBucketIfNotExists(key []byte) (*Bucket, error) {
+	child, err := b.CreateBucket(key)
+	if err == ErrBucketExists {
+		return b.Bucket(key), nil
+	} else if err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// DeleteBucket deletes a nested bucket at the given key and frees all its pages.
+// Returns an error if the bucket does not exist, or if the key represents a non-bucket value.
+func (b *Bucket) DeleteBucket(key []byte) error {
+	if b.tx.db == nil {
+		return ErrTxClosed
+	} else if !b.Writable() {
+		return ErrTxNotWritable
+	}
+
+	// Move cursor to correct position.
+	c := b.Cursor()
+	k, _, flags := c.seek(key)
+
+	// Return an error if bucket doesn't exist or is not a bucket.
+	if !bytes.Equal(key, k) {
+		return ErrBucketNotFound
+	} else if (flags & bucketLeafFlag) == 0 {
+		return ErrIncompatibleValue
+	}
+
+	// Recursively delete all child buckets.
+	child := b.Bucket(key)
+	err := child.ForEach(func(k, v []byte) error {
+		if v == nil {
+			if err := child.DeleteBucket(k); err != nil {
+				return fmt.Errorf("delete bucket: %s", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remove cached copy.
+	delete(b.buckets, string(key))
+
+	// Release all bucket pages to freelist.
+	child.nodes = nil
+	child.rootNode = nil
+	child.free()
+
+	// Delete the node if we have a matching key.
+	c.node().del(key)
+
+	// Drop the index entries and ttls of a top-level bucket.
+	if b == &b.tx.root && !isReserved(key) {
+		return b.tx.dropBucketData(key)
+	}
+	return nil
+}
+
+// Get retrieves the value for a key in the bucket.
+// Returns a nil value if the key does not exist or if the key is a nested bucket.
+// The returned value is only valid for the life of the transaction.
+func (b *Bucket) Get(key []byte) []byte {
+	v, _ := b.get(key)
+	return v
+}
+
+// get retrieves the value for a key and reports whether a plain key/value
+// pair exists, so empty values can be told apart from missing keys.
+func (b *Bucket) get(key []byte) ([]byte, bool) {
+	k, v, flags := b.Cursor().seek(key)
+
+	// Return nil if this is a bucket.
+	if (flags & bucketLeafFlag) != 0 {
+		return nil, false
+	}
+
+	// If our target node isn't the same key as what's passed in then return nil.
+	if !bytes.Equal(key, k) {
+		return nil, false
+	}
+	return v, true
+}
+
+// Put sets the value for a key in the bucket.
+// If the key exist then its previous value will be overwritten.
+// Returns an error if the bucket was created from a read-only transaction,
+// if the key is blank, if the key is too large, or if the value is too large.
+func (b *Bucket) Put(key []byte, value []byte) error {
+	if b.tx.db == nil {
+		return ErrTxClosed
+	} else if !b.Writable() {
+		return ErrTxNotWritable
+	} else if len(key) == 0 {
+		return ErrKeyRequired
+	} else if len(key) > MaxKeySize {
+		return ErrKeyTooLarge
+	} else if int64(len(value)) > MaxValueSize {
+		return ErrValueTooLarge
+	}
+
+	// Move cursor to correct position.
+	c := b.Cursor()
+	k, _, flags := c.seek(key)
+
+	// Return an error if there is an existing key with a bucket value.
+	if bytes.Equal(key, k) && (flags&bucketLeafFlag) != 0 {
+		return ErrIncompatibleValue
+	}
+
+	// Keep the indexes and ttls of a top-level bucket in sync, a plain Put
+	// makes the key persistent.
+	if b.hooked() {
+		old, ok := b.get(key)
+		if err := b.updateIndexes(key, present(old, ok), present(value, true)); err != nil {
+			return err
+		}
+		if err := b.clearTTL(key); err != nil {
+			return err
+		}
+	}
+
+	// Insert into node.
+	key = cloneBytes(key)
+	c.node().put(key, key, cloneBytes(value), 0, 0)
+
+	return nil
+}
+
+// Delete removes a key from the bucket.
+// If the key does not exist then nothing is done and a nil error is returned.
+// Returns an error if the bucket was created from a read-only transaction,
+// or if the key is a nested bucket.
+func (b *Bucket) Delete(key []byte) error {
+	if b.tx.db == nil {
+		return ErrTxClosed
+	} else if !b.Writable() {
+		return ErrTxNotWritable
+	}
+
+	_, err := b.remove(key)
+	return err
+}
+
+// remove removes a key, it reports whether the key existed.
+func (b *Bucket) remove(key []byte) (bool, error) {
+	c := b.Cursor()
+	k, v, flags := c.seek(key)
+
+	// Return nil if the key doesn't exist.
+	if !bytes.Equal(key, k) {
+		return false, nil
+	}
+
+	// Return an error if there is already existing bucket value.
+	if (flags & bucketLeafFlag) != 0 {
+		return false, ErrIncompatibleValue
+	}
+
+	if err := b.unhook(key, v); err != nil {
+		return false, err
+	}
+
+	// Delete the node if we have a matching key.
+	c.node().del(key)
+	return true, nil
+}
+
+// Range returns up to size records in key order, starting at the first key
+// greater than or equal to key. Nested buckets are skipped.
+func (b *Bucket) Range(key []byte, size int) []Record {
+	var records []Record
+
+	c := b.Cursor()
+	for k, v, flags := c.seekNext(key); k != nil && len(records) < size; k, v, flags = c.next() {
+		if (flags & bucketLeafFlag) != 0 {
+			continue
+		}
+		records = append(records, Record{Key: cloneBytes(k), Value: cloneBytes(v)})
+	}
+	return records
+}
+
+// ForEach executes a function for each key/value pair in a bucket.
+// Nested buckets are passed with a nil value.
+// If the provided function returns an error then the iteration is stopped and
+// the error is returned to the caller. The provided function must not modify
+// the bucket; this will result in undefined behavior.
+func (b *Bucket) ForEach(fn func(k, v []byte) error) error {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sequence returns the current integer for the bucket without incrementing it.
+func (b *Bucket) Sequence() uint64 {
+	return b.bucket.sequence
+}
+
+// NextSequence returns an autoincrementing integer for the bucket.
+func (b *Bucket) NextSequence() (uint64, error) {
+	if b.tx.db == nil {
+		return 0, ErrTxClosed
+	} else if !b.Writable() {
+		return 0, ErrTxNotWritable
+	}
+
+	// Materialize the root node if it hasn't been already so that the
+	// bucket will be saved during commit.
+	if b.rootNode == nil && b.root != 0 {
+		_ = b.node(b.root, nil)
+	}
+
+	b.bucket.sequence++
+	return b.bucket.sequence, nil
+}
+
+// SetSequence updates the sequence number for the bucket.
+func (b *Bucket) SetSequence(v uint64) error {
+	if b.tx.db == nil {
+		return ErrTxClosed
+	} else if !b.Writable() {
+		return ErrTxNotWritable
+	}
+
+	// Materialize the root node if it hasn't been already so that the
+	// bucket will be saved during commit.
+	if b.rootNode == nil && b.root != 0 {
+		_ = b.node(b.root, nil)
+	}
+
+	b.bucket.sequence = v
+	return nil
+}
+
+// BucketStats records statistics about resources used by a bucket.
+type BucketStats struct {
+	BranchPageN int // number of logical branch pages
+	LeafPageN   int // number of logical leaf pages
+	OverflowN   int // number of physical overflow pages
+	KeyN        int // number of keys/value pairs, nested buckets included
+	Depth       int // number of levels in the B+tree
+	BucketN     int // total number of buckets including the top bucket
+	LeafInuse   int // bytes actually used for leaf data
+}
+
+// Add adds the statistics of another bucket.
+func (s *BucketStats) Add(other BucketStats) {
+	s.BranchPageN += other.BranchPageN
+	s.LeafPageN += other.LeafPageN
+	s.OverflowN += other.OverflowN
+	s.KeyN += other.KeyN
+	if s.Depth < other.Depth {
+		s.Depth = other.Depth
+	}
+	s.BucketN += other.BucketN
+	s.LeafInuse += other.LeafInuse
+}
+
+// Stats retrieves stats on a bucket and all of its nested buckets.
+// Only the committed pages are counted, pending changes of a writable
+// transaction are not included.
+func (b *Bucket) Stats() BucketStats {
+	var s, subStats BucketStats
+	s.BucketN = 1
+	if b.root == 0 {
+		return s
+	}
+
+	b.forEachPageNode(func(p *page, n *node, depth int) {
+		if p == nil {
+			if n.pgid == 0 {
+				return
+			}
+			p = b.tx.page(n.pgid)
+		}
+		if (p.flags & leafPageFlag) != 0 {
+			s.KeyN += int(p.count)
+			s.LeafPageN++
+			s.LeafInuse += pageHeaderSize
+			if p.count != 0 {
+				// Element data ends right after the data of the last element.
+				lastElement := p.leafPageElement(p.count - 1)
+				s.LeafInuse += leafPageElementSize * int(p.count-1)
+				s.LeafInuse += int(lastElement.pos + lastElement.ksize + lastElement.vsize)
+			}
+
+			// Collect stats from the nested buckets.
+			for i := uint16(0); i < p.count; i++ {
+				e := p.leafPageElement(i)
+				if (e.flags & bucketLeafFlag) != 0 {
+					subStats.Add(b.openBucket(e.value()).Stats())
+				}
+			}
+		} else if (p.flags & branchPageFlag) != 0 {
+			s.BranchPageN++
+		}
+		s.OverflowN += int(p.overflow)
+		if depth+1 > s.Depth {
+			s.Depth = depth + 1
+		}
+	})
+
+	s.Add(subStats)
+	return s
+}
+
+// forEachPage iterates over every page (or node) in a bucket.
+func (b *Bucket) forEachPageNode(fn func(*page, *node, int)) {
+	b._forEachPageNode(b.root, 0, fn)
+}
+
+func (b *Bucket) _forEachPageNode(id pgid, depth int, fn func(*page, *node, int)) {
+	p, n := b.pageNode(id)
+
+	// Execute function.
+	fn(p, n, depth)
+
+	// Recursively loop over children.
+	if p != nil {
+		if (p.flags & branchPageFlag) != 0 {
+			for i := 0; i < int(p.count); i++ {
+				elem := p.branchPageElement(uint16(i))
+				b._forEachPageNode(elem.pgid, depth+1, fn)
+			}
+		}
+	} else {
+		if !n.isLeaf {
+			for _, item := range n.inodes {
+				b._forEachPageNode(item.pgid, depth+1, fn)
+			}
+		}
+	}
+}
+
+// free recursively frees all pages in the bucket.
+func (b *Bucket) free() {
+	if b.root == 0 {
+		return
+	}
+
+	tx := b.tx
+	b.forEachPageNode(func(p *page, n *node, _ int) {
+		if p != nil {
+			tx.db.freelist.free(tx.meta.txid, p)
+		} else {
+			n.free()
+		}
+	})
+	b.root = 0
+}
+
+// pageNode returns the in-memory node, if it exists.
+// Otherwise returns the underlying page.
+func (b *Bucket) pageNode(id pgid) (*page, *node) {
+	// A new bucket only has a root node until it is spilled.
+	if b.root == 0 {
+		if id != 0 {
+			panic(fmt.Sprintf("new bucket non-zero page access(2): %d != 0", id))
+		}
+		return nil, b.rootNode
+	}
+
+	if b.nodes != nil {
+		if n := b.nodes[id]; n != nil {
+			return nil, n
+		}
+	}
+	return b.tx.page(id), nil
+}
+
+// node creates a node from a page and associates it with a given parent.
+func (b *Bucket) node(id pgid, parent *node) *node {
+	if b.nodes == nil {
+		panic("nodes map expected")
+	}
+
+	// Retrieve node if it's already been created.
+	if n := b.nodes[id]; n != nil {
+		return n
+	}
+
+	// Otherwise create a node and cache it.
+	n := &node{bucket: b, parent: parent}
+	if parent == nil {
+		b.rootNode = n
+	} else {
+		parent.children = append(parent.children, n)
+	}
+	n.read(b.tx.page(id))
+	b.nodes[id] = n
+
+	return n
+}
+
+// rebalance attempts to balance all nodes.
+func (b *Bucket) rebalance() {
+	for _, n := range b.nodes {
+		n.rebalance()
+	}
+	for _, child := range b.buckets {
+		child.rebalance()
+	}
+}
+
+// spill writes all the nodes for this bucket to dirty pages.
+func (b *Bucket) spill() error {
+	// Spill all child buckets first.
+	for name, child := range b.buckets {
+		if err := child.spill(); err != nil {
+			return err
+		}
+
+		// Skip writing the bucket if there are no materialized nodes.
+		if child.rootNode == nil {
+			continue
+		}
+
+		// Update parent node.
+		c := b.Cursor()
+		k, _, flags := c.seek([]byte(name))
+		if !bytes.Equal([]byte(name), k) {
+			panic(fmt.Sprintf("misplaced bucket header: %x -> %x", []byte(name), k))
+		}
+		if flags&bucketLeafFlag == 0 {
+			panic(fmt.Sprintf("unexpected bucket header flag: %x", flags))
+		}
+		c.node().put([]byte(name), []byte(name), child.bucket.encode(), 0, bucketLeafFlag)
+	}
+
+	// Ignore if there's not a materialized root node.
+	if b.rootNode == nil {
+		return nil
+	}
+
+	// Spill nodes.
+	if err := b.rootNode.spill(); err != nil {
+		return err
+	}
+	b.rootNode = b.rootNode.root()
+
+	// Update the root node for this bucket.
+	if b.rootNode.pgid >= b.tx.meta.pgid {
+		panic(fmt.Sprintf("pgid (%d) above high water mark (%d)", b.rootNode.pgid, b.tx.meta.pgid))
+	}
+	b.root = b.rootNode.pgid
+
+	return nil
+}
+
+// dereference removes all references to the old mmap.
+func (b *Bucket) dereference() {
+	if b.rootNode != nil {
+		b.rootNode.root().dereference()
+	}
+
+	for _, child := range b.buckets {
+		child.dereference()
+	}
+}
@@ -0,0 +1,267 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_PutGet(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+	assert.Nil(t, db.Put([]byte("b"), []byte("2")))
+	assert.Nil(t, db.Put([]byte("a"), []byte("3")))
+
+	value, found := db.Get([]byte("a"))
+	assert.True(t, found)
+	assert.Equal(t, []byte("3"), value)
+
+	_, found = db.Get([]byte("c"))
+	assert.False(t, found)
+
+	assert.Equal(t, ErrKeyRequired, db.Put(nil, []byte("x")))
+	assert.Equal(t, ErrKeyTooLarge, db.Put(make([]byte, MaxKeySize+1), nil))
+}
+
+func TestDB_Persistence(t *testing.T) {
+	path := tempPath(t)
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	const n = 2000
+	for _, i := range rand.Perm(n) {
+		key := []byte(fmt.Sprintf("key-%05d", i))
+		assert.Nil(t, db.Put(key, make([]byte, 100)))
+	}
+	assert.Nil(t, db.Close())
+
+	db, err = Open(path)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	for i := 0; i < n; i++ {
+		_, found := db.Get([]byte(fmt.Sprintf("key-%05d", i)))
+		assert.True(t, found, i)
+	}
+
+	records := db.Range([]byte("key-00100"), 5)
+	assert.Len(t, records, 5)
+	for i, r := range records {
+		assert.Equal(t, fmt.Sprintf("key-%05d", 100+i), string(r.Key))
+	}
+
+	// seek key between two keys starts at the next one
+	records = db.Range([]byte("key-00100a"), 1)
+	assert.Equal(t, "key-00101", string(records[0].Key))
+	assert.Len(t, db.Range([]byte("key-01998"), 10), 2)
+}
+
+func TestDB_Remove(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	const n = 1000
+	for i := 0; i < n; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("%04d", i)), []byte(fmt.Sprint(i))))
+	}
+	for _, i := range rand.Perm(n) {
+		if i%3 == 0 {
+			continue
+		}
+		found, err := db.Remove([]byte(fmt.Sprintf("%04d", i)))
+		assert.Nil(t, err)
+		assert.True(t, found)
+	}
+
+	found, err := db.Remove([]byte("missing"))
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	records := db.Range(nil, n)
+	assert.Len(t, records, (n+2)/3)
+	for i, r := range records {
+		assert.Equal(t, fmt.Sprintf("%04d", i*3), string(r.Key))
+	}
+
+	// freed pages are reused instead of growing the file
+	hwm := db.meta().pgid
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put([]byte(fmt.Sprintf("%04d", i)), nil))
+	}
+	assert.LessOrEqual(t, db.meta().pgid, hwm)
+}
+
+func TestDB_LargeValue(t *testing.T) {
+	path := tempPath(t)
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	value := make([]byte, 5*db.pageSize)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	assert.Nil(t, db.Put([]byte("large"), value))
+	assert.Nil(t, db.Close())
+
+	db, err = Open(path)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	v, found := db.Get([]byte("large"))
+	assert.True(t, found)
+	assert.Equal(t, value, v)
+}
+
+func TestTx_CreateBucket(t *testing.T) {
+	path := tempPath(t)
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		users, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 500; i++ {
+			if err := users.Put([]byte(fmt.Sprintf("user-%04d", i)), []byte("u")); err != nil {
+				return err
+			}
+		}
+
+		orders, err := tx.CreateBucket([]byte("orders"))
+		if err != nil {
+			return err
+		}
+		if _, err := orders.CreateBucket([]byte("2024")); err != nil {
+			return err
+		}
+		return orders.Put([]byte("o-1"), []byte("1"))
+	}))
+
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		_, err := tx.CreateBucket([]byte("users"))
+		assert.Equal(t, ErrBucketExists, err)
+		_, err = tx.CreateBucket(nil)
+		assert.Equal(t, ErrBucketNameRequired, err)
+		b, err := tx.CreateBucketIfNotExists([]byte("users"))
+		assert.Nil(t, err)
+		assert.NotNil(t, b)
+
+		// keys and buckets don't mix
+		assert.Equal(t, ErrIncompatibleValue, tx.Put([]byte("users"), []byte("x")))
+		assert.Equal(t, ErrIncompatibleValue, tx.Delete([]byte("users")))
+		assert.Nil(t, tx.Get([]byte("users")))
+		return nil
+	}))
+	assert.Nil(t, db.Close())
+
+	db, err = Open(path)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		users := tx.Bucket([]byte("users"))
+		assert.NotNil(t, users)
+		assert.Equal(t, []byte("u"), users.Get([]byte("user-0042")))
+		assert.Nil(t, users.Get([]byte("o-1")))
+
+		orders := tx.Bucket([]byte("orders"))
+		assert.NotNil(t, orders)
+		assert.Equal(t, []byte("1"), orders.Get([]byte("o-1")))
+		assert.NotNil(t, orders.Bucket([]byte("2024")))
+		assert.Nil(t, tx.Bucket([]byte("missing")))
+
+		var names []string
+		assert.Nil(t, tx.ForEach(func(name []byte, b *Bucket) error {
+			names = append(names, string(name))
+			return nil
+		}))
+		assert.Equal(t, []string{"orders", "users"}, names)
+
+		_, err := tx.CreateBucket([]byte("x"))
+		assert.Equal(t, ErrTxNotWritable, err)
+		return nil
+	}))
+}
+
+func TestTx_DeleteBucket(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucket([]byte("widgets"))
+		if err != nil {
+			return err
+		}
+		child, err := b.CreateBucket([]byte("child"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 1000; i++ {
+			if err := child.Put([]byte(fmt.Sprintf("%04d", i)), make([]byte, 100)); err != nil {
+				return err
+			}
+		}
+		return tx.Put([]byte("plain"), []byte("v"))
+	}))
+	hwm := db.meta().pgid
+
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		assert.Equal(t, ErrIncompatibleValue, tx.DeleteBucket([]byte("plain")))
+		assert.Equal(t, ErrBucketNotFound, tx.DeleteBucket([]byte("missing")))
+		return tx.DeleteBucket([]byte("widgets"))
+	}))
+
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		assert.Nil(t, tx.Bucket([]byte("widgets")))
+		return nil
+	}))
+
+	// the pages of the deleted bucket are reused by the next writes
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucket([]byte("widgets"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 1000; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("%04d", i)), make([]byte, 100)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	assert.LessOrEqual(t, int(db.meta().pgid), int(hwm)+2)
+}
+
+func TestBucket_NextSequence(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucket([]byte("seq"))
+		if err != nil {
+			return err
+		}
+		for i := 1; i <= 3; i++ {
+			seq, err := b.NextSequence()
+			assert.Nil(t, err)
+			assert.Equal(t, uint64(i), seq)
+		}
+		return nil
+	}))
+
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		assert.Equal(t, uint64(3), tx.Bucket([]byte("seq")).Sequence())
+		return nil
+	}))
+}
@@ -1,5 +1,356 @@
-package cmd
+// Copyright (c) 2013 Ben Johnson. All rights reserved.
+// Parts of this file are derived from bbolt, https://github.com/etcd-io/bbolt,
+// use of this source code is governed by a MIT style license that can be
+// found in the ../LICENSE.bbolt file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"pkgx/storage/singledb"
+)
+
+var (
+	// ErrUsage is returned when a usage message was printed and the process
+	// should simply exit with an error.
+	ErrUsage = errors.New("usage")
+
+	// ErrBucketNotFound is returned when the bucket path does not exist.
+	ErrBucketNotFound = errors.New("bucket not found")
+
+	// ErrKeyNotFound is returned when a key is not found.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrCorrupt is returned when the check command finds inconsistencies.
+	ErrCorrupt = errors.New("database check failed: corrupt")
+)
+
+const usage = `singledb is a tool for inspecting singledb data files.
+
+Usage:
+
+	singledb <command> [arguments]
+
+The commands are:
+
+	stats    <path>                     print database and bucket statistics
+	buckets  <path>                     list the top-level buckets
+	keys     <path> <bucket>...         list the keys of a bucket
+	get      <path> <bucket>... <key>   print the value of a key
+	dump     <path> [<bucket>...]       dump key/value pairs as JSON lines
+	compact  [-tx-max-size n] <src> <dst>
+	                                    copy the database into a dense new file
+	check    <path>                     verify page and freelist consistency
+
+Nested buckets are addressed by listing their names from the top.
+`
+
+// openTimeout is how long the commands wait for the file lock.
+const openTimeout = 5 * time.Second
 
 func main() {
+	if err := run(os.Stdout, os.Args[1:]...); err == ErrUsage {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run dispatches the command line to a sub command.
+func run(w io.Writer, args ...string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprint(os.Stderr, usage)
+		return ErrUsage
+	}
+
+	switch args[0] {
+	case "stats":
+		return runStats(w, args[1:])
+	case "buckets":
+		return runBuckets(w, args[1:])
+	case "keys":
+		return runKeys(w, args[1:])
+	case "get":
+		return runGet(w, args[1:])
+	case "dump":
+		return runDump(w, args[1:])
+	case "compact":
+		return runCompact(w, args[1:])
+	case "check":
+		return runCheck(w, args[1:])
+	case "help":
+		fmt.Fprint(w, usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q, run 'singledb help' for usage", args[0])
+	}
+}
+
+// openReadOnly opens an existing data file with a shared lock.
+func openReadOnly(path string) (*singledb.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return singledb.Open(path, singledb.WithReadOnly(true), singledb.WithTimeout(openTimeout))
+}
+
+// findBucket follows a path of bucket names from the top-level buckets.
+func findBucket(tx *singledb.Tx, names []string) (*singledb.Bucket, error) {
+	b := tx.Bucket([]byte(names[0]))
+	for _, name := range names[1:] {
+		if b == nil {
+			break
+		}
+		b = b.Bucket([]byte(name))
+	}
+	if b == nil {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, strings.Join(names, "/"))
+	}
+	return b, nil
+}
+
+func runStats(w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: singledb stats <path>")
+	}
+
+	db, err := openReadOnly(args[0])
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	stats := db.Stats()
+	fmt.Fprintf(w, "Page size: %d\n", stats.PageSize)
+	fmt.Fprintf(w, "Page count: %d\n", stats.PageN)
+	fmt.Fprintf(w, "Free pages: %d\n", stats.FreePageN)
+	fmt.Fprintf(w, "Pending pages: %d\n", stats.PendingPageN)
+	fmt.Fprintf(w, "Freelist size: %d bytes\n", stats.FreelistInuse)
+	fmt.Fprintf(w, "Transaction id: %d\n", stats.TxID)
+
+	return db.View(func(tx *singledb.Tx) error {
+		var total singledb.BucketStats
+		if err := tx.ForEach(func(name []byte, b *singledb.Bucket) error {
+			total.Add(b.Stats())
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "Data size: %d bytes\n", tx.Size())
+		fmt.Fprintf(w, "Buckets: %d\n", total.BucketN)
+		fmt.Fprintf(w, "Keys: %d\n", total.KeyN)
+		fmt.Fprintf(w, "Max depth: %d\n", total.Depth)
+		fmt.Fprintf(w, "Branch pages: %d\n", total.BranchPageN)
+		fmt.Fprintf(w, "Leaf pages: %d\n", total.LeafPageN)
+		fmt.Fprintf(w, "Overflow pages: %d\n", total.OverflowN)
+		if total.LeafPageN > 0 {
+			fill := float64(total.LeafInuse) / float64((total.LeafPageN+total.OverflowN)*stats.PageSize)
+			fmt.Fprintf(w, "Leaf fill: %.1f%%\n", fill*100)
+		}
+		return nil
+	})
+}
+
+func runBuckets(w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: singledb buckets <path>")
+	}
+
+	db, err := openReadOnly(args[0])
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *singledb.Tx) error {
+		return tx.ForEach(func(name []byte, _ *singledb.Bucket) error {
+			_, err := fmt.Fprintln(w, string(name))
+			return err
+		})
+	})
+}
+
+func runKeys(w io.Writer, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: singledb keys <path> <bucket>...")
+	}
+
+	db, err := openReadOnly(args[0])
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *singledb.Tx) error {
+		b, err := findBucket(tx, args[1:])
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			_, err := fmt.Fprintln(w, string(k))
+			return err
+		})
+	})
+}
+
+func runGet(w io.Writer, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: singledb get <path> <bucket>... <key>")
+	}
+
+	db, err := openReadOnly(args[0])
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	key := args[len(args)-1]
+	return db.View(func(tx *singledb.Tx) error {
+		b, err := findBucket(tx, args[1:len(args)-1])
+		if err != nil {
+			return err
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		}
+		_, err = fmt.Fprintln(w, string(v))
+		return err
+	})
+}
+
+// dumpRecord is a key/value pair written by the dump command.
+// Keys and values that are not valid UTF-8 are base64 encoded.
+type dumpRecord struct {
+	Bucket []string `json:"bucket"`
+	Key    string   `json:"key"`
+	Value  string   `json:"value"`
+	Base64 bool     `json:"base64,omitempty"`
+}
+
+func runDump(w io.Writer, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: singledb dump <path> [<bucket>...]")
+	}
+
+	db, err := openReadOnly(args[0])
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	enc := json.NewEncoder(w)
+	return db.View(func(tx *singledb.Tx) error {
+		if len(args) > 1 {
+			b, err := findBucket(tx, args[1:])
+			if err != nil {
+				return err
+			}
+			return dumpBucket(enc, args[1:], b)
+		}
+		return tx.ForEach(func(name []byte, b *singledb.Bucket) error {
+			return dumpBucket(enc, []string{string(name)}, b)
+		})
+	})
+}
+
+// dumpBucket writes every key/value pair of a bucket and its nested buckets.
+func dumpBucket(enc *json.Encoder, path []string, b *singledb.Bucket) error {
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			child := append(path[:len(path):len(path)], string(k))
+			return dumpBucket(enc, child, b.Bucket(k))
+		}
+
+		r := dumpRecord{Bucket: path, Key: string(k), Value: string(v)}
+		if !utf8.Valid(k) || !utf8.Valid(v) {
+			r.Key = base64.StdEncoding.EncodeToString(k)
+			r.Value = base64.StdEncoding.EncodeToString(v)
+			r.Base64 = true
+		}
+		return enc.Encode(r)
+	})
+}
+
+func runCompact(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("compact", flag.ContinueOnError)
+	txMaxSize := fs.Int64("tx-max-size", singledb.DefaultCompactTxMaxSize, "commit the destination every n bytes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: singledb compact [-tx-max-size n] <src> <dst>")
+	}
+	srcPath, dstPath := fs.Arg(0), fs.Arg(1)
+
+	if _, err := os.Stat(dstPath); err == nil {
+		return fmt.Errorf("destination file already exists: %s", dstPath)
+	}
+
+	src, err := openReadOnly(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := singledb.Open(dstPath, singledb.WithTimeout(openTimeout))
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if err := singledb.Compact(dst, src, *txMaxSize); err != nil {
+		return err
+	}
+
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	dstInfo, err := os.Stat(dstPath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d -> %d bytes\n", srcInfo.Size(), dstInfo.Size())
+	return nil
+}
+
+func runCheck(w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: singledb check <path>")
+	}
+
+	db, err := openReadOnly(args[0])
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *singledb.Tx) error {
+		var count int
+		for err := range tx.Check() {
+			fmt.Fprintln(w, err)
+			count++
+		}
 
+		if count > 0 {
+			return fmt.Errorf("%w: %d errors found", ErrCorrupt, count)
+		}
+		fmt.Fprintln(w, "OK")
+		return nil
+	})
 }
@@ -0,0 +1,132 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pkgx/storage/singledb"
+)
+
+// fixture creates a database with two buckets, one of them nested.
+func fixture(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := singledb.Open(path)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Update(func(tx *singledb.Tx) error {
+		users, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 100; i++ {
+			if err := users.Put([]byte(fmt.Sprintf("user-%03d", i)), []byte(fmt.Sprint(i))); err != nil {
+				return err
+			}
+		}
+		if _, err := users.NextSequence(); err != nil {
+			return err
+		}
+
+		orders, err := tx.CreateBucket([]byte("orders"))
+		if err != nil {
+			return err
+		}
+		archive, err := orders.CreateBucket([]byte("archive"))
+		if err != nil {
+			return err
+		}
+		if err := archive.Put([]byte("o-1"), []byte{0xff, 0x00}); err != nil {
+			return err
+		}
+		return orders.Put([]byte("o-2"), []byte("open"))
+	}))
+	return path
+}
+
+func TestRun_Inspect(t *testing.T) {
+	path := fixture(t)
+
+	var out bytes.Buffer
+	assert.Nil(t, run(&out, "buckets", path))
+	assert.Equal(t, "orders\nusers\n", out.String())
+
+	out.Reset()
+	assert.Nil(t, run(&out, "keys", path, "orders"))
+	assert.Equal(t, "archive\no-2\n", out.String())
+
+	out.Reset()
+	assert.Nil(t, run(&out, "get", path, "users", "user-042"))
+	assert.Equal(t, "42\n", out.String())
+
+	assert.ErrorIs(t, run(&out, "get", path, "users", "missing"), ErrKeyNotFound)
+	assert.ErrorIs(t, run(&out, "keys", path, "orders", "missing"), ErrBucketNotFound)
+
+	out.Reset()
+	assert.Nil(t, run(&out, "stats", path))
+	assert.Contains(t, out.String(), "Keys: 103\n")
+	assert.Contains(t, out.String(), "Buckets: 3\n")
+
+	out.Reset()
+	assert.Nil(t, run(&out, "check", path))
+	assert.Equal(t, "OK\n", out.String())
+
+	assert.NotNil(t, run(&out, "unknown"))
+}
+
+func TestRun_Dump(t *testing.T) {
+	path := fixture(t)
+
+	var out bytes.Buffer
+	assert.Nil(t, run(&out, "dump", path))
+
+	var records []dumpRecord
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var r dumpRecord
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	assert.Len(t, records, 102)
+	assert.Equal(t, dumpRecord{Bucket: []string{"orders", "archive"}, Key: "by0x", Value: "/wA=", Base64: true}, records[0])
+	assert.Equal(t, dumpRecord{Bucket: []string{"orders"}, Key: "o-2", Value: "open"}, records[1])
+	assert.Equal(t, "users", records[2].Bucket[0])
+}
+
+func TestRun_Compact(t *testing.T) {
+	src := fixture(t)
+	dst := filepath.Join(t.TempDir(), "compact.db")
+
+	var out bytes.Buffer
+	assert.Nil(t, run(&out, "compact", "-tx-max-size", "64", src, dst))
+	assert.True(t, strings.HasSuffix(out.String(), " bytes\n"))
+
+	// the destination must not be overwritten
+	assert.NotNil(t, run(&out, "compact", src, dst))
+
+	var srcDump, dstDump bytes.Buffer
+	assert.Nil(t, run(&srcDump, "dump", src))
+	assert.Nil(t, run(&dstDump, "dump", dst))
+	assert.Equal(t, srcDump.String(), dstDump.String())
+
+	db, err := singledb.Open(dst, singledb.WithReadOnly(true))
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.View(func(tx *singledb.Tx) error {
+		assert.Equal(t, uint64(1), tx.Bucket([]byte("users")).Sequence())
+		return nil
+	}))
+
+	out.Reset()
+	assert.Nil(t, run(&out, "check", dst))
+	assert.Equal(t, "OK\n", out.String())
+}
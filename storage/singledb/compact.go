@@ -0,0 +1,127 @@
+// Copyright (c) 2013 Ben Johnson. All rights reserved.
+// Parts of this file are derived from bbolt, https://github.com/etcd-io/bbolt,
+// use of this source code is governed by a MIT style license that can be
+// found in the LICENSE.bbolt file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"fmt"
+	"os"
+)
+
+// DefaultCompactTxMaxSize is the amount of key/value bytes copied in one
+// transaction of the destination database by DB.Compact.
+const DefaultCompactTxMaxSize = 64 << 20
+
+// Compact writes a dense copy of the database to a new file at path.
+// The copy is made from one read transaction, so it is a consistent snapshot
+// while other readers and the writer continue. The file must not exist.
+//
+// The read transaction holds the mmap for the whole copy, writes that need to
+// grow the mmap are blocked until it finishes.
+func (db *DB) Compact(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("compact: file already exists: %s", path)
+	}
+
+	dst, err := Open(path, WithTimeout(db.timeout))
+	if err != nil {
+		return err
+	}
+	if err = Compact(dst, db, DefaultCompactTxMaxSize); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	return dst.Close()
+}
+
+// Compact copies every key and bucket of src into dst, which are usually an
+// empty database, committing dst whenever the copied data exceeds txMaxSize.
+// A txMaxSize of 0 copies everything in a single transaction.
+func Compact(dst, src *DB, txMaxSize int64) error {
+	tx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	tx.raw = true
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var size int64
+	err = src.View(func(stx *Tx) error {
+		return walk(stx, func(path [][]byte, k, v []byte, seq uint64) error {
+			// Start a new transaction once the current one is large enough.
+			if sz := int64(len(k) + len(v)); txMaxSize != 0 && size+sz > txMaxSize {
+				if err := tx.Commit(); err != nil {
+					return err
+				}
+				// tx stays the committed one if dst cannot begin, its
+				// deferred rollback is a no-op.
+				next, err := dst.Begin(true)
+				if err != nil {
+					return err
+				}
+				tx = next
+				tx.raw = true
+				size = 0
+			}
+			size += int64(len(k) + len(v))
+
+			// Walk the destination to the parent bucket.
+			b := &tx.root
+			for _, name := range path {
+				b = b.Bucket(name)
+			}
+
+			// Buckets are visited before their keys.
+			if v != nil {
+				return b.Put(k, v)
+			}
+			child, err := b.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return child.SetSequence(seq)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// The internal buckets are copied as they are, dst sweeps the copied ttls.
+	if dst.sweeper != nil {
+		return dst.scheduleTTLs()
+	}
+	return nil
+}
+
+// walkFunc is called for every key/value pair, buckets have a nil value.
+type walkFunc func(path [][]byte, k, v []byte, seq uint64) error
+
+// walk walks every key of the transaction in key order, a bucket is visited
+// before its keys.
+func walk(tx *Tx, fn walkFunc) error {
+	return walkBucket(&tx.root, nil, fn)
+}
+
+func walkBucket(b *Bucket, path [][]byte, fn walkFunc) error {
+	return b.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return fn(path, k, v, 0)
+		}
+
+		child := b.Bucket(k)
+		if err := fn(path, k, nil, child.Sequence()); err != nil {
+			return err
+		}
+		return walkBucket(child, append(path[:len(path):len(path)], k), fn)
+	})
+}
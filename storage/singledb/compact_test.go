@@ -0,0 +1,149 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Compact(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	// write and delete most of the data so the file has a lot of free pages
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Update(func(tx *Tx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte("widgets"))
+			if err != nil {
+				return err
+			}
+			sub, err := b.CreateBucketIfNotExists([]byte("sub"))
+			if err != nil {
+				return err
+			}
+			if _, err := sub.NextSequence(); err != nil {
+				return err
+			}
+			for j := 0; j < 200; j++ {
+				if err := b.Put([]byte(fmt.Sprintf("%02d-%03d", i, j)), make([]byte, 200)); err != nil {
+					return err
+				}
+			}
+			return sub.Put([]byte(fmt.Sprint(i)), []byte("v"))
+		}))
+	}
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		b := tx.Bucket([]byte("widgets"))
+		for i := 0; i < 9; i++ {
+			for j := 0; j < 200; j++ {
+				if err := b.Delete([]byte(fmt.Sprintf("%02d-%03d", i, j))); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Put([]byte("root"), []byte("value"))
+	}))
+
+	path := filepath.Join(t.TempDir(), "compact.db")
+	assert.Nil(t, db.Compact(path))
+	assert.NotNil(t, db.Compact(path))
+
+	compacted, err := Open(path)
+	assert.Nil(t, err)
+	defer compacted.Close()
+
+	assert.Less(t, int(compacted.meta().pgid), int(db.meta().pgid))
+	assert.Nil(t, compacted.View(func(tx *Tx) error {
+		for err := range tx.Check() {
+			t.Error(err)
+		}
+
+		b := tx.Bucket([]byte("widgets"))
+		assert.Equal(t, 200+1+10, b.Stats().KeyN)
+		assert.NotNil(t, b.Get([]byte("09-199")))
+		assert.Nil(t, b.Get([]byte("08-199")))
+		sub := b.Bucket([]byte("sub"))
+		assert.Equal(t, uint64(10), sub.Sequence())
+		assert.Equal(t, []byte("v"), sub.Get([]byte("9")))
+		assert.Equal(t, []byte("value"), tx.Get([]byte("root")))
+		return nil
+	}))
+}
+
+func TestCompact_Batches(t *testing.T) {
+	src, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer src.Close()
+
+	assert.Nil(t, src.Update(func(tx *Tx) error {
+		for i := 0; i < 3; i++ {
+			b, err := tx.CreateBucket([]byte(fmt.Sprint(i)))
+			if err != nil {
+				return err
+			}
+			for j := 0; j < 100; j++ {
+				if err := b.Put([]byte(fmt.Sprint(j)), []byte("value")); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}))
+
+	path := tempPath(t)
+	dst, err := Open(path)
+	assert.Nil(t, err)
+	defer dst.Close()
+
+	before := dst.Stats().TxID
+	assert.Nil(t, Compact(dst, src, 100))
+	assert.Greater(t, dst.Stats().TxID, before+1)
+
+	assert.Nil(t, dst.View(func(tx *Tx) error {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, 100, tx.Bucket([]byte(fmt.Sprint(i))).Stats().KeyN)
+		}
+		return nil
+	}))
+
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+}
+
+func TestCompact_BeginError(t *testing.T) {
+	src, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer src.Close()
+	assert.Nil(t, src.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucket([]byte("widgets"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 100; i++ {
+			if err := b.Put([]byte(fmt.Sprint(i)), []byte("value")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	dst, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	// dst is closed under the copy once its first transaction commits
+	dst.ops.sync = func(f *os.File) error {
+		dst.opened = false
+		return f.Sync()
+	}
+
+	assert.NotPanics(t, func() {
+		assert.Equal(t, ErrDatabaseNotOpen, Compact(dst, src, 100))
+	})
+	dst.opened = true
+	assert.Nil(t, dst.Close())
+}
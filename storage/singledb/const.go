@@ -1,5 +1,23 @@
+// Copyright (c) 2013 Ben Johnson. All rights reserved.
+// Parts of this file are derived from bbolt, https://github.com/etcd-io/bbolt,
+// use of this source code is governed by a MIT style license that can be
+// found in the LICENSE.bbolt file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
 package singledb
 
+import "os"
+
 const maxDbSize = 0xFFFFFFFFFFFF // 256TB
 
 const maxAllotSize = 0x7FFFFFFF // 2GB
+
+// minMmapSize is the smallest mmap region, the mmap size doubles from here.
+const minMmapSize = 1 << 15 // 32KB
+
+// defaultAllocSize is the chunk the data file grows by once it is larger than the mmap.
+const defaultAllocSize = 16 * 1024 * 1024 // 16MB
+
+// defaultPageSize is the page size of the operating system.
+var defaultPageSize = os.Getpagesize()
@@ -0,0 +1,162 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// crashBucket is the bucket the crash test writes to.
+var crashBucket = []byte("data")
+
+// crashState reads the content of the crash test bucket.
+func crashState(t *testing.T, db *DB) map[string]string {
+	state := make(map[string]string)
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		b := tx.Bucket(crashBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			state[string(k)] = string(v)
+			return nil
+		})
+	}))
+	return state
+}
+
+// crashValue returns a value of a random size, some of them span overflow pages.
+func crashValue(rng *rand.Rand, i int) string {
+	size := rng.Intn(64)
+	if rng.Intn(8) == 0 {
+		size = rng.Intn(3 * defaultPageSize)
+	}
+	v := make([]byte, size)
+	rng.Read(v)
+	return fmt.Sprintf("%d:%x", i, v)
+}
+
+// crashWrite applies a random transaction to the model and the database.
+func crashWrite(rng *rand.Rand, tx *Tx, model map[string]string, i int) error {
+	b, err := tx.CreateBucketIfNotExists(crashBucket)
+	if err != nil {
+		return err
+	}
+	for n := rng.Intn(8) + 1; n > 0; n-- {
+		key := fmt.Sprintf("key-%03d", rng.Intn(200))
+		if rng.Intn(4) == 0 {
+			delete(model, key)
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+			continue
+		}
+		model[key] = crashValue(rng, i)
+		if err := b.Put([]byte(key), []byte(model[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// crashCycle opens the database with injected faults, commits random
+// transactions until a fault fails one or a random crash point and crashes.
+// It returns the states the database may recover to.
+func crashCycle(t *testing.T, rng *rand.Rand, path string, wal bool, model map[string]string) []map[string]string {
+	fs := newFaultFS(rng.Int63())
+	db, err := Open(path, withFaults(fs), WithWAL(wal), WithInitialMmapSize(1<<24),
+		WithCheckpointInterval(time.Millisecond), WithCheckpointSize(64*1024))
+	if !assert.Nil(t, err) {
+		return nil
+	}
+	fs.inject(0.01, 0.02)
+
+	candidates := []map[string]string{model}
+	for i, steps := 0, rng.Intn(50)+1; i < steps; i++ {
+		next := make(map[string]string, len(model))
+		for k, v := range model {
+			next[k] = v
+		}
+		err := db.Update(func(tx *Tx) error {
+			return crashWrite(rng, tx, next, i)
+		})
+		if err == nil {
+			model = next
+			candidates = []map[string]string{model}
+			continue
+		}
+
+		// The outcome of a failed commit is unknown, the database stops
+		// at the first fault.
+		assert.NotZero(t, fs.injected(), err)
+		candidates = append(candidates, next)
+		break
+	}
+
+	fs.crash()
+	_ = db.Close()
+	assert.Nil(t, fs.restore())
+	return candidates
+}
+
+// TestDB_Crash commits random transactions under injected write and fsync
+// faults, simulates a crash and checks the recovered database against an
+// in-memory model: it must hold every committed transaction, a failed commit
+// is either applied or not, and the pages must be consistent.
+func TestDB_Crash(t *testing.T) {
+	seeds, cycles := 20, 5
+	if testing.Short() {
+		seeds = 4
+	}
+
+	for _, wal := range []bool{false, true} {
+		for seed := 1; seed <= seeds; seed++ {
+			wal, seed := wal, int64(seed)
+			t.Run(fmt.Sprintf("wal=%t/seed=%d", wal, seed), func(t *testing.T) {
+				rng := rand.New(rand.NewSource(seed))
+				path := tempPath(t)
+				model := make(map[string]string)
+
+				for cycle := 0; cycle < cycles; cycle++ {
+					candidates := crashCycle(t, rng, path, wal, model)
+
+					db, err := Open(path, WithWAL(wal))
+					if !assert.Nil(t, err, "cycle %d", cycle) {
+						return
+					}
+					state := crashState(t, db)
+					matched := false
+					for _, c := range candidates {
+						if assert.ObjectsAreEqual(c, state) {
+							matched = true
+						}
+					}
+					assert.True(t, matched, "cycle %d: recovered %d keys, expected one of %d states", cycle, len(state), len(candidates))
+					model = state
+
+					ch := make(chan []error)
+					go func() {
+						var errs []error
+						_ = db.View(func(tx *Tx) error {
+							for err := range tx.Check() {
+								errs = append(errs, err)
+							}
+							return nil
+						})
+						ch <- errs
+					}()
+					assert.Empty(t, <-ch, "cycle %d", cycle)
+					assert.Nil(t, db.Close())
+					if t.Failed() {
+						return
+					}
+				}
+			})
+		}
+	}
+}
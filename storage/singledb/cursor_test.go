@@ -0,0 +1,143 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	const n = 1000
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucket([]byte("widgets"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i += 2 {
+			if err := b.Put([]byte(fmt.Sprintf("%04d", i)), []byte(fmt.Sprint(i))); err != nil {
+				return err
+			}
+		}
+		_, err = b.CreateBucket([]byte("sub"))
+		return err
+	}))
+
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		c := tx.Bucket([]byte("widgets")).Cursor()
+
+		k, v := c.First()
+		assert.Equal(t, "0000", string(k))
+		assert.Equal(t, "0", string(v))
+
+		// forward iteration sees every key in order, buckets with a nil value
+		count := 1
+		for k, v = c.Next(); k != nil; k, v = c.Next() {
+			count++
+			if string(k) == "sub" {
+				assert.Nil(t, v)
+			}
+		}
+		assert.Equal(t, n/2+1, count)
+
+		k, v = c.Last()
+		assert.Equal(t, "sub", string(k))
+		assert.Nil(t, v)
+		k, _ = c.Prev()
+		assert.Equal(t, "0998", string(k))
+
+		// backward iteration
+		count = 1
+		for k, _ = c.Prev(); k != nil; k, _ = c.Prev() {
+			count++
+		}
+		assert.Equal(t, n/2, count)
+
+		// seek to an exact key, between keys and past the end
+		k, _ = c.Seek([]byte("0500"))
+		assert.Equal(t, "0500", string(k))
+		k, _ = c.Seek([]byte("0501"))
+		assert.Equal(t, "0502", string(k))
+		k, _ = c.Prev()
+		assert.Equal(t, "0500", string(k))
+		k, _ = c.Seek([]byte("zzz"))
+		assert.Nil(t, k)
+		return nil
+	}))
+}
+
+func TestCursor_Empty(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		c, err := tx.CreateBucket([]byte("empty"))
+		if err != nil {
+			return err
+		}
+		k, _ := c.Cursor().First()
+		assert.Nil(t, k)
+		return nil
+	}))
+
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		c := tx.Bucket([]byte("empty")).Cursor()
+		k, _ := c.First()
+		assert.Nil(t, k)
+		k, _ = c.Last()
+		assert.Nil(t, k)
+		k, _ = c.Seek([]byte("a"))
+		assert.Nil(t, k)
+		return nil
+	}))
+}
+
+func TestCursor_Delete(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucket([]byte("widgets"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 100; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("%03d", i)), []byte("v")); err != nil {
+				return err
+			}
+		}
+		_, err = b.CreateBucket([]byte("sub"))
+		return err
+	}))
+
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		c := tx.Bucket([]byte("widgets")).Cursor()
+		for k, _ := c.Seek([]byte("050")); k != nil && string(k) < "060"; k, _ = c.Seek([]byte("050")) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		c.Last()
+		assert.Equal(t, ErrIncompatibleValue, c.Delete())
+		return nil
+	}))
+
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		b := tx.Bucket([]byte("widgets"))
+		assert.Nil(t, b.Get([]byte("055")))
+		assert.NotNil(t, b.Get([]byte("049")))
+		assert.NotNil(t, b.Get([]byte("060")))
+
+		c := b.Cursor()
+		assert.Equal(t, ErrTxNotWritable, c.Delete())
+		return nil
+	}))
+}
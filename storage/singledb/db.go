@@ -1,17 +1,837 @@
+// Copyright (c) 2013 Ben Johnson. All rights reserved.
+// Parts of this file are derived from bbolt, https://github.com/etcd-io/bbolt,
+// use of this source code is governed by a MIT style license that can be
+// found in the LICENSE.bbolt file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
 package singledb
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"pkgx/recovery"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// flockRetryTimeout is the interval between two attempts to lock the data file.
+const flockRetryTimeout = 50 * time.Millisecond
 
 type DB struct {
-	path string
-	file *os.File
-	data *[maxDbSize]byte
+	path     string
+	file     *os.File
+	dataref  []byte // mmap'ed readonly, write throws SEGV
+	data     *[maxDbSize]byte
+	datasz   int
+	filesz   int // current on disk file size
+	pageSize int
+	opened   bool
+	readOnly bool
+
+	// timeout of waiting for the file lock, 0 waits forever.
+	timeout time.Duration
+	// initialMmapSize is the initial mmap size of the database.
+	initialMmapSize int
 
 	MmapFlags int
 	// truncate() and fsync() when growing the data file.
 	AllocSize int
+
+	// walMode appends commits to a write-ahead log instead of the data file.
+	walMode            bool
+	checkpointInterval time.Duration
+	checkpointSize     int64
+
+	// maxBatchSize and maxBatchDelay bound the calls a Batch commits together.
+	maxBatchSize  int
+	maxBatchDelay time.Duration
+
+	// ttlInterval is the tick of the timing wheel that sweeps expired keys.
+	ttlInterval time.Duration
+
+	meta0    *meta
+	meta1    *meta
+	freelist *freelist
+	wal      *wal
+	rwtx     *Tx
+	txs      []*Tx
+
+	batchMu sync.Mutex
+	batch   *batch
+
+	// indexes are the secondary indexes declared on the top-level buckets.
+	indexlock sync.RWMutex
+	indexes   map[string][]*index
+	sweeper   *sweeper
+
+	// ops are the write operations on the data file and the log.
+	ops fileOps
+
+	// rwlock allows only one writer at a time.
+	rwlock sync.Mutex
+	// metalock protects meta page access and the list of open read transactions.
+	metalock sync.Mutex
+	// mmaplock protects the mmap region while it is remapped, read
+	// transactions hold it for their whole life.
+	mmaplock sync.RWMutex
+	// filelock keeps the data file open under the snapshots, see beginSnapshot.
+	filelock sync.RWMutex
+}
+
+// fileOps are the operations that change the files of a database, the
+// tests replace them to inject faults.
+type fileOps struct {
+	writeAt  func(f *os.File, b []byte, off int64) (int, error)
+	sync     func(f *os.File) error
+	truncate func(f *os.File, size int64) error
+}
+
+// osFileOps are the file operations of the os package.
+var osFileOps = fileOps{
+	writeAt:  (*os.File).WriteAt,
+	sync:     (*os.File).Sync,
+	truncate: (*os.File).Truncate,
+}
+
+// Option defines the method to customize a DB.
+type Option func(db *DB)
+
+// WithTimeout sets the amount of time to wait to obtain the file lock.
+func WithTimeout(timeout time.Duration) Option {
+	return func(db *DB) {
+		db.timeout = timeout
+	}
+}
+
+// WithReadOnly opens the database with a shared lock in read-only mode.
+func WithReadOnly(readOnly bool) Option {
+	return func(db *DB) {
+		db.readOnly = readOnly
+	}
+}
+
+// WithMmapFlags sets extra flags of the mmap call, e.g. syscall.MAP_POPULATE.
+func WithMmapFlags(flags int) Option {
+	return func(db *DB) {
+		db.MmapFlags = flags
+	}
+}
+
+// WithAllocSize sets the chunk size the data file grows by, 16MB by default
+// and at most 2GB.
+func WithAllocSize(size int) Option {
+	return func(db *DB) {
+		db.AllocSize = size
+	}
+}
+
+// WithInitialMmapSize sets the initial mmap size, a large enough value avoids
+// remapping while read transactions are open.
+func WithInitialMmapSize(size int) Option {
+	return func(db *DB) {
+		db.initialMmapSize = size
+	}
+}
+
+// WithWAL enables the write-ahead log mode, commits are appended to a log
+// file next to the data file and checkpointed into it in the background.
+func WithWAL(enabled bool) Option {
+	return func(db *DB) {
+		db.walMode = enabled
+	}
+}
+
+// WithCheckpointInterval sets how often the write-ahead log is checkpointed.
+func WithCheckpointInterval(interval time.Duration) Option {
+	return func(db *DB) {
+		db.checkpointInterval = interval
+	}
+}
+
+// WithCheckpointSize sets the size of the write-ahead log that triggers a
+// checkpoint before the interval passes.
+func WithCheckpointSize(size int64) Option {
+	return func(db *DB) {
+		db.checkpointSize = size
+	}
+}
+
+// WithMaxBatchSize sets the maximum number of calls a Batch commits together.
+func WithMaxBatchSize(size int) Option {
+	return func(db *DB) {
+		db.maxBatchSize = size
+	}
+}
+
+// WithMaxBatchDelay sets the maximum time a Batch waits for more calls
+// before it commits.
+func WithMaxBatchDelay(delay time.Duration) Option {
+	return func(db *DB) {
+		db.maxBatchDelay = delay
+	}
+}
+
+// WithTTLInterval sets the tick of the timing wheel that sweeps the keys put
+// with a ttl, an expired key is deleted within about one tick.
+func WithTTLInterval(interval time.Duration) Option {
+	return func(db *DB) {
+		db.ttlInterval = interval
+	}
 }
 
-func NewDB() *DB {
-	return &DB{}
+// Open creates and opens a database at the given path.
+// If the file does not exist then it will be created automatically.
+func Open(path string, opts ...Option) (*DB, error) {
+	db := &DB{
+		path:               path,
+		pageSize:           defaultPageSize,
+		AllocSize:          defaultAllocSize,
+		checkpointInterval: defaultCheckpointInterval,
+		checkpointSize:     defaultCheckpointSize,
+		maxBatchSize:       defaultMaxBatchSize,
+		maxBatchDelay:      defaultMaxBatchDelay,
+		ttlInterval:        defaultTTLInterval,
+		ops:                osFileOps,
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	if db.AllocSize <= 0 {
+		db.AllocSize = defaultAllocSize
+	} else if db.AllocSize > maxAllotSize {
+		db.AllocSize = maxAllotSize
+	}
+
+	flag := os.O_RDWR
+	if db.readOnly {
+		flag = os.O_RDONLY
+	} else {
+		flag |= os.O_CREATE
+	}
+
+	var err error
+	if db.file, err = os.OpenFile(path, flag, 0666); err != nil {
+		return nil, err
+	}
+
+	// exclusive lock for the writer, shared lock for the readers
+	if err = flock(db, !db.readOnly, db.timeout); err != nil {
+		_ = db.file.Close()
+		return nil, err
+	}
+
+	info, err := db.file.Stat()
+	if err != nil {
+		_ = db.close()
+		return nil, err
+	}
+	db.filesz = int(info.Size())
+
+	if db.filesz == 0 {
+		// Initialize new files with meta pages.
+		if db.readOnly {
+			_ = db.close()
+			return nil, ErrInvalid
+		}
+		if err = db.init(); err != nil {
+			_ = db.close()
+			return nil, err
+		}
+	} else {
+		// Read the first meta page to determine the page size.
+		// If the first page is invalid then the default page size is used,
+		// the second meta page is validated after the mmap.
+		var buf [0x1000]byte
+		if _, err := db.file.ReadAt(buf[:], 0); err != nil {
+			_ = db.close()
+			return nil, err
+		}
+		if m := pageInBuffer(buf[:], 0, 0).meta(); m.validate() == nil {
+			db.pageSize = int(m.pageSize)
+		}
+	}
+
+	// Replay the write-ahead log left behind by a crash.
+	if err = db.openWAL(); err != nil {
+		_ = db.close()
+		return nil, err
+	}
+
+	if err = db.mmap(db.initialMmapSize); err != nil {
+		_ = db.close()
+		return nil, err
+	}
+
+	// Read in the freelist.
+	db.freelist = newFreelist()
+	db.freelist.read(db.latestPage(db.meta().freelist))
+
+	db.opened = true
+
+	// Schedule the sweeps of the keys put with a ttl.
+	if !db.readOnly {
+		db.sweeper = newSweeper(db, db.ttlInterval)
+		if err = db.scheduleTTLs(); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// init creates a new database file with two meta pages, an empty freelist
+// page and an empty leaf page as the root of the tree.
+func (db *DB) init() error {
+	buf := make([]byte, db.pageSize*4)
+
+	// Create two meta pages on a buffer.
+	for i := 0; i < 2; i++ {
+		p := pageInBuffer(buf, db.pageSize, pgid(i))
+		p.id = pgid(i)
+		p.flags = metaPageFlag
+
+		m := p.meta()
+		m.magic = magic
+		m.version = version
+		m.pageSize = uint32(db.pageSize)
+		m.freelist = 2
+		m.root = 3
+		m.pgid = 4
+		m.txid = txid(i)
+		m.checksum = m.sum64()
+	}
+
+	// Write an empty freelist at page 2.
+	p := pageInBuffer(buf, db.pageSize, 2)
+	p.id = 2
+	p.flags = freelistPageFlag
+	p.count = 0
+
+	// Write an empty leaf page at page 3.
+	p = pageInBuffer(buf, db.pageSize, 3)
+	p.id = 3
+	p.flags = leafPageFlag
+	p.count = 0
+
+	if _, err := db.ops.writeAt(db.file, buf, 0); err != nil {
+		return err
+	}
+	if err := db.ops.sync(db.file); err != nil {
+		return err
+	}
+	db.filesz = len(buf)
+	return nil
+}
+
+// Path returns the path to the data file.
+func (db *DB) Path() string {
+	return db.path
+}
+
+// String returns the string representation of the database.
+func (db *DB) String() string {
+	return fmt.Sprintf("DB<%q>", db.path)
+}
+
+// IsReadOnly reports whether the database was opened in read-only mode.
+func (db *DB) IsReadOnly() bool {
+	return db.readOnly
+}
+
+// Stats represents statistics about the database.
+type Stats struct {
+	PageSize      int // page size in bytes
+	PageN         int // high water mark of allocated pages
+	FreePageN     int // total number of free pages on the freelist
+	PendingPageN  int // total number of pending pages on the freelist
+	FreeAlloc     int // total bytes allocated in free pages
+	FreelistInuse int // total bytes used by the freelist
+	OpenTxN       int // number of currently open read transactions
+	TxID          int // id of the last committed transaction
+}
+
+// Stats retrieves ongoing statistics about the database.
+// It waits for the current write transaction to finish.
+func (db *DB) Stats() Stats {
+	db.rwlock.Lock()
+	defer db.rwlock.Unlock()
+
+	db.metalock.Lock()
+	defer db.metalock.Unlock()
+
+	if !db.opened {
+		return Stats{}
+	}
+
+	m := db.meta()
+	return Stats{
+		PageSize:      db.pageSize,
+		PageN:         int(m.pgid),
+		FreePageN:     db.freelist.freeCount(),
+		PendingPageN:  db.freelist.pendingCount(),
+		FreeAlloc:     db.freelist.count() * db.pageSize,
+		FreelistInuse: db.freelist.size(),
+		OpenTxN:       len(db.txs),
+		TxID:          int(m.txid),
+	}
+}
+
+// Close releases all database resources.
+// It waits for the open transactions to finish, in WAL mode the log is
+// checkpointed into the data file.
+func (db *DB) Close() error {
+	if db.sweeper != nil {
+		db.sweeper.close()
+	}
+	if db.wal != nil {
+		db.wal.stop()
+	}
+
+	db.rwlock.Lock()
+	defer db.rwlock.Unlock()
+
+	var err error
+	if db.opened && !db.readOnly {
+		err = db.checkpoint()
+	}
+
+	db.metalock.Lock()
+	defer db.metalock.Unlock()
+
+	db.mmaplock.Lock()
+	defer db.mmaplock.Unlock()
+
+	db.filelock.Lock()
+	defer db.filelock.Unlock()
+
+	if cerr := db.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (db *DB) close() error {
+	if db.file == nil {
+		return nil
+	}
+	db.opened = false
+	db.freelist = nil
+
+	var errs []error
+	if db.wal != nil {
+		if err := db.wal.file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		db.wal = nil
+	}
+	if err := munmap(db); err != nil {
+		errs = append(errs, err)
+	}
+	if err := funlock(db); err != nil {
+		errs = append(errs, err)
+	}
+	if err := db.file.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	db.file = nil
+
+	if len(errs) > 0 {
+		return fmt.Errorf("db close: %v", errs)
+	}
+	return nil
+}
+
+// Begin starts a new transaction.
+// Multiple read-only transactions can be used concurrently but only one
+// write transaction can be used at a time, starting multiple write
+// transactions will block until the current one finishes.
+//
+// Read-only transactions hold the mmap while they are open, a write
+// transaction that needs to remap blocks until they are closed, so a
+// goroutine must not hold a read transaction while opening a write one.
+func (db *DB) Begin(writable bool) (*Tx, error) {
+	if writable {
+		return db.beginRWTx()
+	}
+	return db.beginTx()
+}
+
+func (db *DB) beginTx() (*Tx, error) {
+	// Lock the meta pages while we initialize the transaction, the mmap lock
+	// is held until the transaction closes.
+	db.metalock.Lock()
+	db.mmaplock.RLock()
+
+	if !db.opened {
+		db.mmaplock.RUnlock()
+		db.metalock.Unlock()
+		return nil, ErrDatabaseNotOpen
+	}
+
+	t := &Tx{}
+	t.init(db)
+	db.txs = append(db.txs, t)
+	db.metalock.Unlock()
+
+	return t, nil
+}
+
+// beginSnapshot starts a read-only transaction that does not hold the mmap,
+// so the writers can remap while it is open. It only reads the data file and
+// the pages of the write-ahead log, see Tx.WriteTo, and its version is kept
+// like the one of any read transaction. Close waits for it to be closed.
+func (db *DB) beginSnapshot() (*Tx, error) {
+	db.metalock.Lock()
+	defer db.metalock.Unlock()
+
+	if !db.opened {
+		return nil, ErrDatabaseNotOpen
+	}
+	db.filelock.RLock()
+
+	// The meta is read through the mmap.
+	db.mmaplock.RLock()
+	t := &Tx{unmapped: true}
+	t.init(db)
+	db.mmaplock.RUnlock()
+
+	db.txs = append(db.txs, t)
+	return t, nil
+}
+
+func (db *DB) beginRWTx() (*Tx, error) {
+	if db.readOnly {
+		return nil, ErrDatabaseReadOnly
+	}
+
+	// Obtain writer lock. This is released by the transaction when it closes.
+	db.rwlock.Lock()
+
+	db.metalock.Lock()
+	defer db.metalock.Unlock()
+
+	if !db.opened {
+		db.rwlock.Unlock()
+		return nil, ErrDatabaseNotOpen
+	}
+
+	t := &Tx{writable: true}
+	t.init(db)
+	db.rwtx = t
+
+	// Free any pages associated with closed read-only transactions.
+	db.freePages()
+
+	return t, nil
+}
+
+// freePages releases any pages associated with closed read-only transactions.
+// Pages freed before the oldest reader started are released at once, pages
+// that were allocated and freed between two open readers are released too, so
+// a long running reader does not hold back all of the pages freed after it.
+func (db *DB) freePages() {
+	// Free all pending pages prior to earliest open transaction.
+	sort.Slice(db.txs, func(i, j int) bool {
+		return db.txs[i].meta.txid < db.txs[j].meta.txid
+	})
+	minid := txid(0xFFFFFFFFFFFFFFFF)
+	if len(db.txs) > 0 {
+		minid = db.txs[0].meta.txid
+	}
+	if minid > 0 {
+		db.freelist.release(minid - 1)
+	}
+
+	// Release unused txid extents.
+	for _, t := range db.txs {
+		db.freelist.releaseRange(minid, t.meta.txid-1)
+		minid = t.meta.txid + 1
+	}
+	db.freelist.releaseRange(minid, txid(0xFFFFFFFFFFFFFFFF))
+}
+
+// removeTx removes a read-only transaction from the database.
+func (db *DB) removeTx(tx *Tx) {
+	if tx.unmapped {
+		db.filelock.RUnlock()
+	} else {
+		db.mmaplock.RUnlock()
+	}
+
+	db.metalock.Lock()
+	for i, t := range db.txs {
+		if t == tx {
+			last := len(db.txs) - 1
+			db.txs[i] = db.txs[last]
+			db.txs[last] = nil
+			db.txs = db.txs[:last]
+			break
+		}
+	}
+	db.metalock.Unlock()
+}
+
+// Update executes a function within the context of a read-write managed transaction.
+// If no error is returned from the function then the transaction is committed.
+// If an error is returned or the function panics then the entire transaction
+// is rolled back, a panic is returned as an error.
+func (db *DB) Update(fn func(*Tx) error) error {
+	t, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the transaction rolls back in the event of a panic.
+	if err = db.call(t, fn); err != nil {
+		t.rollback()
+		return err
+	}
+	return t.Commit()
+}
+
+// View executes a function within the context of a managed read-only transaction.
+// Any error or panic of the function is returned.
+func (db *DB) View(fn func(*Tx) error) error {
+	t, err := db.Begin(false)
+	if err != nil {
+		return err
+	}
+
+	err = db.call(t, fn)
+	t.rollback()
+	return err
+}
+
+// call runs fn on a managed transaction, a panic is recovered into an error.
+func (db *DB) call(t *Tx, fn func(*Tx) error) error {
+	t.managed = true
+	_, err := recovery.Hook[struct{}](func() (struct{}, error) {
+		return struct{}{}, fn(t)
+	})
+	t.managed = false
+	return err
+}
+
+// Put sets the value for a key, like BPlusTree.Put the existing value is replaced.
+// Every call is committed in its own transaction.
+func (db *DB) Put(key, value []byte) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.Put(key, value)
+	})
+}
+
+// Get returns a copy of the value for a key.
+func (db *DB) Get(key []byte) (value []byte, found bool) {
+	_ = db.View(func(tx *Tx) error {
+		if v, ok := tx.root.get(key); ok {
+			value, found = cloneBytes(v), true
+		}
+		return nil
+	})
+	return value, found
+}
+
+// Remove deletes a key and reports whether it existed.
+func (db *DB) Remove(key []byte) (found bool, err error) {
+	err = db.Update(func(tx *Tx) error {
+		var err error
+		found, err = tx.root.remove(key)
+		return err
+	})
+	return found, err
+}
+
+// Range returns up to size records in key order, starting at the first key
+// greater than or equal to key.
+func (db *DB) Range(key []byte, size int) (records []Record) {
+	_ = db.View(func(tx *Tx) error {
+		records = tx.Range(key, size)
+		return nil
+	})
+	return records
+}
+
+// page retrieves a page reference from the mmap based on the current page size.
+func (db *DB) page(id pgid) *page {
+	pos := id * pgid(db.pageSize)
+	return (*page)(unsafe.Pointer(&db.data[pos]))
+}
+
+// latestPage retrieves a page of the last committed version, a page of the
+// write-ahead log that is not checkpointed yet is preferred over the mmap.
+// It must only be called by the writer.
+func (db *DB) latestPage(id pgid) *page {
+	if db.wal != nil {
+		if p, ok := db.wal.pages[id]; ok {
+			return p
+		}
+	}
+	return db.page(id)
+}
+
+// meta retrieves the current meta page reference.
+func (db *DB) meta() *meta {
+	// The last record of the write-ahead log is newer than the data file.
+	if db.wal != nil && db.wal.meta != nil {
+		return db.wal.meta
+	}
+
+	// We have to return the meta with the highest txid which doesn't fail
+	// validation. Otherwise, we can cause errors when in fact the database is
+	// in a consistent state. metaA is the one with the higher txid.
+	metaA, metaB := db.meta0, db.meta1
+	if db.meta1.txid > db.meta0.txid {
+		metaA, metaB = db.meta1, db.meta0
+	}
+
+	// Use higher meta page if valid. Otherwise, fallback to previous, if valid.
+	if err := metaA.validate(); err == nil {
+		return metaA
+	} else if err := metaB.validate(); err == nil {
+		return metaB
+	}
+
+	// This should never be reached, because both meta1 and meta0 were validated
+	// on mmap() and we do fsync() on every write.
+	panic("singledb.DB.meta(): invalid meta pages")
+}
+
+// allocate returns a contiguous block of memory starting at a given page.
+// Pages are taken from the freelist first, then from the end of the file.
+func (db *DB) allocate(txid txid, count int) (*page, error) {
+	buf := make([]byte, count*db.pageSize)
+	p := (*page)(unsafe.Pointer(&buf[0]))
+	p.overflow = uint32(count - 1)
+
+	// Use pages from the freelist if they are available.
+	if p.id = db.freelist.allocate(txid, count); p.id != 0 {
+		return p, nil
+	}
+
+	// Resize mmap() if we're at the end.
+	p.id = db.rwtx.meta.pgid
+	minsz := int((p.id+pgid(count))+1) * db.pageSize
+	if minsz >= db.datasz {
+		if err := db.mmap(minsz); err != nil {
+			return nil, fmt.Errorf("mmap allocate error: %s", err)
+		}
+	}
+
+	// Move the page id high water mark.
+	db.rwtx.meta.pgid += pgid(count)
+	db.freelist.allocs[p.id] = txid
+	return p, nil
+}
+
+// mmap opens the underlying memory-mapped file and initializes the meta references.
+// minsz is the minimum size that the new mmap can be.
+func (db *DB) mmap(minsz int) error {
+	db.mmaplock.Lock()
+	defer db.mmaplock.Unlock()
+
+	size := db.filesz
+	if size < minsz {
+		size = minsz
+	}
+	size, err := db.mmapSize(size)
+	if err != nil {
+		return err
+	}
+	if size == db.datasz {
+		return nil
+	}
+
+	// Dereference all mmap references before unmapping.
+	if db.rwtx != nil {
+		db.rwtx.root.dereference()
+	}
+
+	if err := munmap(db); err != nil {
+		return fmt.Errorf("unmap error: %v", err)
+	}
+	if err := mmap(db, size); err != nil {
+		return fmt.Errorf("mmap error: %v", err)
+	}
+
+	// Save references to the meta pages.
+	db.meta0 = db.page(0).meta()
+	db.meta1 = db.page(1).meta()
+
+	// Validate the meta pages. We only return an error if both meta pages fail
+	// validation, since meta0 failing validation means that it wasn't saved
+	// properly -- but we can recover using meta1. And vice-versa.
+	err0 := db.meta0.validate()
+	err1 := db.meta1.validate()
+	if err0 != nil && err1 != nil {
+		return err0
+	}
+	return nil
+}
+
+// mmapSize determines the appropriate size for the mmap given the current size.
+// The size doubles from minMmapSize until 1GB, then grows by maxAllotSize
+// at a time, the result is aligned to the page size.
+func (db *DB) mmapSize(size int) (int, error) {
+	for sz := minMmapSize; sz <= 1<<30; sz <<= 1 {
+		if size <= sz {
+			return sz, nil
+		}
+	}
+
+	if size > maxDbSize {
+		return 0, fmt.Errorf("mmap too large")
+	}
+
+	sz := int64(size)
+	if remainder := sz % maxAllotSize; remainder > 0 {
+		sz += maxAllotSize - remainder
+	}
+
+	pageSize := int64(db.pageSize)
+	if (sz % pageSize) != 0 {
+		sz = ((sz / pageSize) + 1) * pageSize
+	}
+
+	if sz > maxDbSize {
+		sz = maxDbSize
+	}
+	return int(sz), nil
+}
+
+// grow grows the size of the data file to at least sz bytes.
+// The file is grown by AllocSize chunks once it is larger than the mmap,
+// which keeps truncate() and fsync() out of most commits.
+func (db *DB) grow(sz int) error {
+	if db.readOnly {
+		return ErrDatabaseReadOnly
+	}
+	if sz <= db.filesz {
+		return nil
+	}
+
+	// If the data is smaller than the alloc size then only allocate what's needed.
+	// Once it goes over the allocation size then allocate in chunks.
+	if db.datasz <= db.AllocSize {
+		if sz < db.datasz {
+			sz = db.datasz
+		}
+	} else {
+		sz += db.AllocSize
+	}
+	if sz > maxDbSize {
+		return fmt.Errorf("database too large")
+	}
+
+	if err := db.ops.truncate(db.file, int64(sz)); err != nil {
+		return fmt.Errorf("file resize error: %s", err)
+	}
+	if err := db.ops.sync(db.file); err != nil {
+		return fmt.Errorf("file sync error: %s", err)
+	}
+
+	db.filesz = sz
+	return nil
 }
@@ -0,0 +1,120 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempPath(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "single.db")
+}
+
+// putN writes the keys [from, to) into the widgets bucket, in one
+// transaction or in one transaction per key.
+func putN(t *testing.T, db *DB, from, to int, perKey bool) {
+	put := func(tx *Tx, from, to int) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("widgets"))
+		if err != nil {
+			return err
+		}
+		for i := from; i < to; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("%04d", i)), make([]byte, 300)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !perKey {
+		assert.Nil(t, db.Update(func(tx *Tx) error {
+			return put(tx, from, to)
+		}))
+		return
+	}
+	for i := from; i < to; i++ {
+		assert.Nil(t, db.Update(func(tx *Tx) error {
+			return put(tx, i, i+1)
+		}))
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := tempPath(t)
+	db, err := Open(path)
+	assert.Nil(t, err)
+	assert.Equal(t, path, db.Path())
+	assert.Equal(t, minMmapSize, db.datasz)
+	assert.Nil(t, db.Close())
+
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+}
+
+func TestOpen_Locked(t *testing.T) {
+	path := tempPath(t)
+	db, err := Open(path)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	_, err = Open(path, WithTimeout(100*time.Millisecond))
+	assert.Equal(t, ErrTimeout, err)
+}
+
+func TestDB_Grow(t *testing.T) {
+	path := tempPath(t)
+	db, err := Open(path, WithAllocSize(1<<16))
+	assert.Nil(t, err)
+
+	// within the mmap the file grows to the mmap size
+	assert.Nil(t, db.grow(db.filesz+1))
+	assert.Equal(t, db.datasz, db.filesz)
+
+	// beyond the alloc size the file grows in AllocSize chunks
+	assert.Nil(t, db.mmap(1<<17))
+	assert.Nil(t, db.grow(1<<17))
+	assert.Equal(t, 1<<17+1<<16, db.filesz)
+	assert.Nil(t, db.Close())
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1<<17+1<<16), info.Size())
+
+	db, err = Open(path, WithReadOnly(true))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrDatabaseReadOnly, db.grow(1<<20))
+	assert.Nil(t, db.Close())
+}
+
+func TestDB_AllocSize(t *testing.T) {
+	for _, c := range []struct{ in, out int }{
+		{0, defaultAllocSize},
+		{-1, defaultAllocSize},
+		{1 << 16, 1 << 16},
+		{maxAllotSize, maxAllotSize},
+	} {
+		db, err := Open(tempPath(t), WithAllocSize(c.in))
+		assert.Nil(t, err)
+		assert.Equal(t, c.out, db.AllocSize)
+		assert.Nil(t, db.Close())
+	}
+}
+
+func TestDB_MmapSize(t *testing.T) {
+	db := &DB{pageSize: 4096}
+	for _, c := range []struct{ in, out int }{
+		{0, minMmapSize},
+		{minMmapSize + 1, minMmapSize << 1},
+		{1 << 30, 1 << 30},
+		{1<<30 + 1, 1 << 31},
+	} {
+		sz, err := db.mmapSize(c.in)
+		assert.Nil(t, err)
+		assert.Equal(t, c.out, sz)
+	}
+}
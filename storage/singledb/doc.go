@@ -0,0 +1,8 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+// Package singledb is an embedded key/value store of a single file, a
+// copy-on-write B+tree in the manner of bbolt.
+//
+// The data file is memory mapped and locked with flock, the package only
+// builds on the unix systems that support them: linux, darwin and the BSDs.
+package singledb
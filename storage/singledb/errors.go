@@ -0,0 +1,86 @@
+// Copyright (c) 2013 Ben Johnson. All rights reserved.
+// Parts of this file are derived from bbolt, https://github.com/etcd-io/bbolt,
+// use of this source code is governed by a MIT style license that can be
+// found in the LICENSE.bbolt file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import "errors"
+
+var (
+	// ErrDatabaseNotOpen is returned when a DB instance is accessed before it
+	// is opened or after it is closed.
+	ErrDatabaseNotOpen = errors.New("database not open")
+
+	// ErrDatabaseReadOnly is returned when a write is requested on a database
+	// opened in read-only mode.
+	ErrDatabaseReadOnly = errors.New("database is in read-only mode")
+
+	// ErrTimeout is returned when the file lock can not be obtained in time.
+	ErrTimeout = errors.New("timeout")
+)
+
+var (
+	// ErrInvalid is returned when the data file is not a singledb file.
+	ErrInvalid = errors.New("invalid database")
+
+	// ErrChecksum is returned when a meta page checksum does not match.
+	ErrChecksum = errors.New("checksum error")
+
+	// ErrVersionMismatch is returned when the data file was created with a
+	// different version of the file format.
+	ErrVersionMismatch = errors.New("version mismatch")
+
+	// ErrKeyRequired is returned when inserting a zero-length key.
+	ErrKeyRequired = errors.New("key required")
+
+	// ErrKeyTooLarge is returned when inserting a key larger than MaxKeySize.
+	ErrKeyTooLarge = errors.New("key too large")
+
+	// ErrValueTooLarge is returned when inserting a value larger than MaxValueSize.
+	ErrValueTooLarge = errors.New("value too large")
+
+	// ErrIncompatibleValue is returned when trying to create or delete a bucket
+	// on an existing non-bucket key or when trying to create or delete a
+	// non-bucket key on an existing bucket key.
+	ErrIncompatibleValue = errors.New("incompatible value")
+)
+
+var (
+	// ErrBucketNotFound is returned when trying to access a bucket that has
+	// not been created yet.
+	ErrBucketNotFound = errors.New("bucket not found")
+
+	// ErrBucketExists is returned when creating a bucket that already exists.
+	ErrBucketExists = errors.New("bucket already exists")
+
+	// ErrBucketNameRequired is returned when creating a bucket with a blank name.
+	ErrBucketNameRequired = errors.New("bucket name required")
+
+	// ErrBucketNameReserved is returned when a top-level bucket name starts
+	// with a zero byte, such names are used by the indexes and ttls.
+	ErrBucketNameReserved = errors.New("bucket name reserved")
+
+	// ErrBucketNotTopLevel is returned when a ttl is set in a nested bucket.
+	ErrBucketNotTopLevel = errors.New("bucket is not a top-level bucket")
+)
+
+var (
+	// ErrIndexNameRequired is returned when creating an index with a blank name.
+	ErrIndexNameRequired = errors.New("index name required")
+
+	// ErrIndexNotFound is returned when using an index that has not been created.
+	ErrIndexNotFound = errors.New("index not found")
+)
+
+var (
+	// ErrTxNotWritable is returned when performing a write operation on a
+	// read-only transaction.
+	ErrTxNotWritable = errors.New("tx not writable")
+
+	// ErrTxClosed is returned when committing or rolling back a transaction
+	// that has already been committed or rolled back.
+	ErrTxClosed = errors.New("tx closed")
+)
@@ -0,0 +1,207 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"sync"
+)
+
+// errInjected is returned by the file operations that fail on purpose.
+var errInjected = errors.New("injected fault")
+
+// faultSectorSize is the unit a torn write is cut at.
+const faultSectorSize = 512
+
+// faultFS is a fault injection layer under the file writes of a database.
+//
+// The writes go through to the files so the database keeps running on its
+// mmap, the layer tracks which of them are durable: a write is durable once
+// its file is synced. A simulated crash rebuilds every file from its durable
+// content plus a random fate for each unsynced write: dropped, written, or
+// torn at a sector boundary.
+type faultFS struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	files    map[string]*faultFile
+	syncErr  float64 // probability of a failed fsync
+	writeErr float64 // probability of a failed, partial write
+	faults   int     // number of injected faults
+	crashed  bool
+}
+
+// faultFile is the durable content of a file and its unsynced operations.
+type faultFile struct {
+	durable []byte
+	pending []faultOp
+}
+
+// faultOp is a write, or a truncate to off if data is nil.
+type faultOp struct {
+	off  int64
+	data []byte
+}
+
+func newFaultFS(seed int64) *faultFS {
+	return &faultFS{
+		rng:   rand.New(rand.NewSource(seed)),
+		files: make(map[string]*faultFile),
+	}
+}
+
+// withFaults installs a fault injection layer under the file writes.
+func withFaults(fs *faultFS) Option {
+	return func(db *DB) {
+		db.ops = fileOps{
+			writeAt:  fs.writeAt,
+			sync:     fs.sync,
+			truncate: fs.truncate,
+		}
+	}
+}
+
+// inject sets the probabilities of failed writes and fsyncs.
+func (fs *faultFS) inject(writeErr, syncErr float64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.writeErr, fs.syncErr = writeErr, syncErr
+}
+
+// injected returns the number of injected faults.
+func (fs *faultFS) injected() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.faults
+}
+
+// file returns the state of a file, the content of a file seen for the first
+// time is durable.
+func (fs *faultFS) file(f *os.File) *faultFile {
+	ff := fs.files[f.Name()]
+	if ff == nil {
+		data, _ := os.ReadFile(f.Name())
+		ff = &faultFile{durable: data}
+		fs.files[f.Name()] = ff
+	}
+	return ff
+}
+
+func (fs *faultFS) writeAt(f *os.File, b []byte, off int64) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.crashed {
+		return 0, errInjected
+	}
+	ff := fs.file(f)
+
+	// A failed write may have written some sectors.
+	var err error
+	if fs.rng.Float64() < fs.writeErr {
+		fs.faults++
+		b = b[:fs.rng.Intn(len(b)/faultSectorSize+1)*faultSectorSize]
+		err = errInjected
+	}
+
+	n, werr := f.WriteAt(b, off)
+	ff.pending = append(ff.pending, faultOp{off: off, data: append([]byte{}, b[:n]...)})
+	if werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+func (fs *faultFS) sync(f *os.File) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.crashed {
+		return errInjected
+	}
+	ff := fs.file(f)
+
+	// The unsynced writes of a failed fsync may still be lost.
+	if fs.rng.Float64() < fs.syncErr {
+		fs.faults++
+		return errInjected
+	}
+	for _, op := range ff.pending {
+		ff.durable = op.apply(ff.durable, len(op.data))
+	}
+	ff.pending = nil
+	return nil
+}
+
+func (fs *faultFS) truncate(f *os.File, size int64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.crashed {
+		return errInjected
+	}
+	ff := fs.file(f)
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	ff.pending = append(ff.pending, faultOp{off: size})
+	return nil
+}
+
+// crash fails every later operation, the database is closed after a crash
+// and the files are rebuilt by restore.
+func (fs *faultFS) crash() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.crashed = true
+}
+
+// restore rewrites the files with what survived the crash.
+func (fs *faultFS) restore() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for name, ff := range fs.files {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			continue
+		}
+
+		data := append([]byte{}, ff.durable...)
+		for _, op := range ff.pending {
+			switch fs.rng.Intn(3) {
+			case 0: // dropped
+			case 1:
+				data = op.apply(data, len(op.data))
+			case 2: // torn
+				if op.data != nil {
+					data = op.apply(data, fs.rng.Intn(len(op.data)/faultSectorSize+1)*faultSectorSize)
+				}
+			}
+		}
+		if err := os.WriteFile(name, data, 0666); err != nil {
+			return err
+		}
+	}
+	fs.files = make(map[string]*faultFile)
+	return nil
+}
+
+// apply applies the first n bytes of a write, or a truncate, to the content of a file.
+func (op faultOp) apply(data []byte, n int) []byte {
+	if op.data == nil {
+		if int64(len(data)) > op.off {
+			return data[:op.off]
+		}
+		return append(data, make([]byte, op.off-int64(len(data)))...)
+	}
+
+	if n > len(op.data) {
+		n = len(op.data)
+	}
+	if end := op.off + int64(n); int64(len(data)) < end {
+		data = append(data, make([]byte, end-int64(len(data)))...)
+	}
+	copy(data[op.off:], op.data[:n])
+	return data
+}
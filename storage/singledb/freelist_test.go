@@ -0,0 +1,47 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreelist_ReleaseRange(t *testing.T) {
+	f := newFreelist()
+
+	// page 10 was allocated by tx 2 and freed by tx 5, page 20 was
+	// allocated by tx 6 and freed by tx 8.
+	f.allocs[10] = 2
+	f.free(5, &page{id: 10})
+	f.allocs[20] = 6
+	f.free(8, &page{id: 20, overflow: 1})
+	assert.Equal(t, 3, f.pendingCount())
+
+	// a reader at tx 4 still sees page 10, but nothing after tx 5
+	f.releaseRange(5, 0xFFFFFFFFFFFFFFFF)
+	assert.Equal(t, []pgid{20, 21}, f.ids)
+	assert.Equal(t, 1, f.pendingCount())
+
+	f.release(5)
+	assert.Equal(t, []pgid{10, 20, 21}, f.ids)
+	assert.Equal(t, 0, f.pendingCount())
+}
+
+func TestFreelist_Rollback(t *testing.T) {
+	f := newFreelist()
+	f.allocs[10] = 2
+
+	// tx 3 allocated page 30 and freed pages 10 and 30
+	f.allocs[30] = 3
+	f.free(3, &page{id: 10})
+	f.free(3, &page{id: 30})
+	f.rollback(3)
+
+	assert.Equal(t, 0, f.pendingCount())
+	assert.False(t, f.freed(10))
+	assert.Equal(t, txid(2), f.allocs[10])
+	_, ok := f.allocs[30]
+	assert.False(t, ok)
+}
@@ -0,0 +1,379 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import "bytes"
+
+// IndexFunc extracts the index key of a value, a nil index key leaves the
+// value out of the index.
+type IndexFunc func(value []byte) []byte
+
+// index is a secondary index declared on a top-level bucket.
+type index struct {
+	name string
+	fn   IndexFunc
+}
+
+// indexBucket is the internal top-level bucket of the secondary indexes, it
+// holds a bucket per indexed bucket with a bucket per index inside.
+var indexBucket = []byte("\x00index")
+
+// isReserved reports whether a top-level bucket name is reserved for the
+// internal buckets. Reserved buckets are hidden from Tx.ForEach.
+func isReserved(name []byte) bool {
+	return len(name) > 0 && name[0] == 0
+}
+
+// CreateIndex declares a secondary index on a top-level bucket. Every Put and
+// Delete on the bucket maintains the index in the same transaction, the keys
+// are looked up by index key with Bucket.Lookup and Bucket.ScanIndex.
+//
+// The extractor is not stored in the file, CreateIndex must be called after
+// every Open before the bucket is written. The existing keys of the bucket
+// are indexed when the index is created for the first time, an index whose
+// extractor changed is rebuilt by DropIndex and CreateIndex.
+func (db *DB) CreateIndex(bucket []byte, name string, fn IndexFunc) error {
+	if len(bucket) == 0 {
+		return ErrBucketNameRequired
+	} else if isReserved(bucket) {
+		return ErrBucketNameReserved
+	} else if name == "" {
+		return ErrIndexNameRequired
+	}
+
+	// The index is registered while the writer lock is held, no other write
+	// transaction sees it before it is built.
+	idx := &index{name: name, fn: fn}
+	err := db.Update(func(tx *Tx) error {
+		db.registerIndex(string(bucket), idx)
+		return tx.buildIndex(bucket, idx)
+	})
+	if err != nil {
+		db.unregisterIndex(string(bucket), idx)
+	}
+	return err
+}
+
+// DropIndex removes a secondary index and its entries. The index is
+// maintained until the transaction commits, it is kept if DropIndex fails.
+func (db *DB) DropIndex(bucket []byte, name string) error {
+	return db.Update(func(tx *Tx) error {
+		parent := tx.root.Bucket(indexBucket)
+		if parent != nil {
+			parent = parent.Bucket(bucket)
+		}
+		if parent == nil || parent.Bucket([]byte(name)) == nil {
+			return ErrIndexNotFound
+		}
+		if err := parent.DeleteBucket([]byte(name)); err != nil {
+			return err
+		}
+
+		// An index created again once the writer lock is released is kept.
+		if idx := db.registeredIndex(string(bucket), name); idx != nil {
+			tx.OnCommit(func() {
+				db.unregisterIndex(string(bucket), idx)
+			})
+		}
+		return nil
+	})
+}
+
+// registerIndex adds an index to the registry, replacing one with the same name.
+func (db *DB) registerIndex(bucket string, idx *index) {
+	db.indexlock.Lock()
+	defer db.indexlock.Unlock()
+
+	if db.indexes == nil {
+		db.indexes = make(map[string][]*index)
+	}
+	indexes := make([]*index, 0, len(db.indexes[bucket])+1)
+	for _, other := range db.indexes[bucket] {
+		if other.name != idx.name {
+			indexes = append(indexes, other)
+		}
+	}
+	db.indexes[bucket] = append(indexes, idx)
+}
+
+// registeredIndex returns the index of the registry with the given name.
+func (db *DB) registeredIndex(bucket string, name string) *index {
+	db.indexlock.RLock()
+	defer db.indexlock.RUnlock()
+
+	for _, idx := range db.indexes[bucket] {
+		if idx.name == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+// unregisterIndex removes an index from the registry, unless it has been
+// replaced.
+func (db *DB) unregisterIndex(bucket string, idx *index) {
+	db.indexlock.Lock()
+	defer db.indexlock.Unlock()
+
+	var indexes []*index
+	for _, other := range db.indexes[bucket] {
+		if other != idx {
+			indexes = append(indexes, other)
+		}
+	}
+	if len(indexes) == 0 {
+		delete(db.indexes, bucket)
+		return
+	}
+	db.indexes[bucket] = indexes
+}
+
+// buildIndex creates the bucket of an index and indexes the existing keys,
+// an index that already exists is kept.
+func (tx *Tx) buildIndex(bucket []byte, idx *index) error {
+	parent, err := tx.root.CreateBucketIfNotExists(indexBucket)
+	if err != nil {
+		return err
+	}
+	if parent, err = parent.CreateBucketIfNotExists(bucket); err != nil {
+		return err
+	}
+	if parent.Bucket([]byte(idx.name)) != nil {
+		return nil
+	}
+	entries, err := parent.CreateBucket([]byte(idx.name))
+	if err != nil {
+		return err
+	}
+
+	b := tx.root.Bucket(bucket)
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil
+		}
+		if ik := idx.fn(v); ik != nil {
+			return entries.Put(indexEntry(ik, k), []byte{})
+		}
+		return nil
+	})
+}
+
+// dropBucketData removes the index entries and the ttls of a deleted
+// top-level bucket. The indexes stay declared, they are empty.
+func (tx *Tx) dropBucketData(name []byte) error {
+	if parent := tx.root.Bucket(indexBucket); parent != nil {
+		if indexes := parent.Bucket(name); indexes != nil {
+			var names [][]byte
+			_ = indexes.ForEach(func(k, _ []byte) error {
+				names = append(names, cloneBytes(k))
+				return nil
+			})
+			for _, k := range names {
+				if err := indexes.DeleteBucket(k); err != nil {
+					return err
+				}
+				if _, err := indexes.CreateBucket(k); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if parent := tx.root.Bucket(ttlBucket); parent != nil && parent.Bucket(name) != nil {
+		return parent.DeleteBucket(name)
+	}
+	return nil
+}
+
+// hooked reports whether the writes to a bucket maintain indexes and ttls.
+// Compaction copies the internal buckets as they are, its writes are not hooked.
+func (b *Bucket) hooked() bool {
+	return b.name != nil && !b.tx.raw
+}
+
+// unhook removes the index entries and the ttl of a key being deleted.
+func (b *Bucket) unhook(key, value []byte) error {
+	if !b.hooked() {
+		return nil
+	}
+	if err := b.updateIndexes(key, present(value, true), nil); err != nil {
+		return err
+	}
+	return b.clearTTL(key)
+}
+
+// present returns a non-nil value for a key that exists and nil otherwise,
+// so an empty value is told apart from a missing key.
+func present(v []byte, ok bool) []byte {
+	if !ok {
+		return nil
+	} else if v == nil {
+		return []byte{}
+	}
+	return v
+}
+
+// indexes returns the indexes declared on a top-level bucket.
+func (b *Bucket) indexes() []*index {
+	b.tx.db.indexlock.RLock()
+	defer b.tx.db.indexlock.RUnlock()
+	return b.tx.db.indexes[string(b.name)]
+}
+
+// indexEntries returns the bucket holding the entries of an index, nil if
+// the index was not created.
+func (b *Bucket) indexEntries(name string) *Bucket {
+	parent := b.tx.root.Bucket(indexBucket)
+	if parent == nil {
+		return nil
+	}
+	if parent = parent.Bucket(b.name); parent == nil {
+		return nil
+	}
+	return parent.Bucket([]byte(name))
+}
+
+// updateIndexes moves the index entries of a key from its old value to its
+// new value, a nil value is a missing key. The entries are checked before
+// any index is changed.
+func (b *Bucket) updateIndexes(key, old, value []byte) error {
+	type change struct {
+		entries  *Bucket
+		del, put []byte
+	}
+
+	var changes []change
+	for _, idx := range b.indexes() {
+		var oldKey, newKey []byte
+		if old != nil {
+			oldKey = idx.fn(old)
+		}
+		if value != nil {
+			newKey = idx.fn(value)
+		}
+		if (oldKey == nil) == (newKey == nil) && bytes.Equal(oldKey, newKey) {
+			continue
+		}
+
+		// The index is not built yet, CreateIndex indexes the bucket.
+		entries := b.indexEntries(idx.name)
+		if entries == nil {
+			continue
+		}
+
+		ch := change{entries: entries}
+		if oldKey != nil {
+			ch.del = indexEntry(oldKey, key)
+		}
+		if newKey != nil {
+			if ch.put = indexEntry(newKey, key); len(ch.put) > MaxKeySize {
+				return ErrKeyTooLarge
+			}
+		}
+		changes = append(changes, ch)
+	}
+
+	for _, ch := range changes {
+		if ch.del != nil {
+			if _, err := ch.entries.remove(ch.del); err != nil {
+				return err
+			}
+		}
+		if ch.put != nil {
+			if err := ch.entries.Put(ch.put, []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup returns the keys whose value has the given index key, in key order.
+// Returns ErrIndexNotFound if the index was not created.
+func (b *Bucket) Lookup(index string, indexKey []byte) ([][]byte, error) {
+	var keys [][]byte
+	to := append(cloneBytes(indexKey), 0)
+	err := b.ScanIndex(index, indexKey, to, func(_, k, _ []byte) error {
+		keys = append(keys, cloneBytes(k))
+		return nil
+	})
+	return keys, err
+}
+
+// ScanIndex calls fn for every key of the bucket with an index key in the
+// range [from, to), in index key order and then key order. A nil from starts
+// at the first index key, a nil to scans to the last one.
+// The slices passed to fn are only valid for the life of the transaction.
+// Returns ErrIndexNotFound if the index was not created.
+func (b *Bucket) ScanIndex(index string, from, to []byte, fn func(indexKey, key, value []byte) error) error {
+	if b.tx.db == nil {
+		return ErrTxClosed
+	}
+	entries := b.indexEntries(index)
+	if entries == nil {
+		return ErrIndexNotFound
+	}
+
+	c := entries.Cursor()
+	for k, _ := c.Seek(escapeIndexKey(nil, from)); k != nil; k, _ = c.Next() {
+		ik, key, ok := splitIndexEntry(k)
+		if !ok || bytes.Compare(ik, from) < 0 {
+			continue
+		}
+		if to != nil && bytes.Compare(ik, to) >= 0 {
+			break
+		}
+		if err := fn(ik, key, b.Get(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexEntry returns the key of an index entry: the escaped index key, a
+// terminator and the key. The escaping keeps the entries in index key order
+// even when an index key is a prefix of another.
+func indexEntry(indexKey, key []byte) []byte {
+	buf := make([]byte, 0, len(indexKey)+len(key)+4)
+	buf = escapeIndexKey(buf, indexKey)
+	buf = append(buf, 0x00, 0x01)
+	return append(buf, key...)
+}
+
+// escapeIndexKey appends an index key with every 0x00 byte as 0x00 0xFF.
+func escapeIndexKey(buf, indexKey []byte) []byte {
+	for _, c := range indexKey {
+		if c == 0x00 {
+			buf = append(buf, 0x00, 0xFF)
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// splitIndexEntry splits the key of an index entry into the index key and the key.
+func splitIndexEntry(entry []byte) (indexKey, key []byte, ok bool) {
+	for i := 0; i+1 < len(entry); i++ {
+		if entry[i] != 0x00 {
+			indexKey = append(indexKey, entry[i])
+			continue
+		}
+		switch entry[i+1] {
+		case 0xFF:
+			indexKey = append(indexKey, 0x00)
+			i++
+		case 0x01:
+			if indexKey == nil {
+				indexKey = []byte{}
+			}
+			return indexKey, entry[i+2:], true
+		default:
+			return nil, nil, false
+		}
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,189 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cityOf indexes values of the form "name@city" by city.
+func cityOf(value []byte) []byte {
+	if i := bytes.IndexByte(value, '@'); i >= 0 {
+		return value[i+1:]
+	}
+	return nil
+}
+
+func lookup(t *testing.T, db *DB, city string) (keys []string) {
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		found, err := tx.Bucket([]byte("users")).Lookup("city", []byte(city))
+		for _, k := range found {
+			keys = append(keys, string(k))
+		}
+		return err
+	}))
+	return keys
+}
+
+func TestDB_CreateIndex(t *testing.T) {
+	path := tempPath(t)
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	// existing keys are indexed when the index is created
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		_ = b.Put([]byte("u1"), []byte("ann@paris"))
+		_ = b.Put([]byte("u2"), []byte("bob@rome"))
+		return b.Put([]byte("u3"), []byte("no city"))
+	}))
+	assert.Nil(t, db.CreateIndex([]byte("users"), "city", cityOf))
+	assert.Equal(t, []string{"u1"}, lookup(t, db, "paris"))
+
+	// writes maintain the index in the same transaction
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		b := tx.Bucket([]byte("users"))
+		_ = b.Put([]byte("u2"), []byte("bob@paris"))
+		_ = b.Put([]byte("u4"), []byte("dan@par"))
+		found, err := b.Lookup("city", []byte("paris"))
+		assert.Equal(t, [][]byte{[]byte("u1"), []byte("u2")}, found)
+		return err
+	}))
+	assert.Empty(t, lookup(t, db, "rome"))
+	assert.Equal(t, []string{"u4"}, lookup(t, db, "par"))
+
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		b := tx.Bucket([]byte("users"))
+		if err := b.Delete([]byte("u1")); err != nil {
+			return err
+		}
+		c := b.Cursor()
+		c.Seek([]byte("u4"))
+		return c.Delete()
+	}))
+	assert.Equal(t, []string{"u2"}, lookup(t, db, "paris"))
+	assert.Empty(t, lookup(t, db, "par"))
+
+	// a rolled back write leaves the index unchanged
+	assert.NotNil(t, db.Update(func(tx *Tx) error {
+		_ = tx.Bucket([]byte("users")).Put([]byte("u5"), []byte("eve@paris"))
+		return fmt.Errorf("rollback")
+	}))
+	assert.Equal(t, []string{"u2"}, lookup(t, db, "paris"))
+
+	// the index is hidden from the top-level buckets
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		var names []string
+		_ = tx.ForEach(func(name []byte, _ *Bucket) error {
+			names = append(names, string(name))
+			return nil
+		})
+		assert.Equal(t, []string{"users"}, names)
+		assert.Nil(t, tx.Bucket(indexBucket))
+		return nil
+	}))
+	assert.Nil(t, db.Close())
+
+	// the index entries persist, the extractor is declared again
+	db, err = Open(path)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, db.CreateIndex([]byte("users"), "city", cityOf))
+	assert.Equal(t, []string{"u2"}, lookup(t, db, "paris"))
+
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		return tx.Bucket([]byte("users")).Put([]byte("u6"), []byte("fay@paris"))
+	}))
+	assert.Equal(t, []string{"u2", "u6"}, lookup(t, db, "paris"))
+
+	assert.Nil(t, db.DropIndex([]byte("users"), "city"))
+	assert.Equal(t, ErrIndexNotFound, db.DropIndex([]byte("users"), "city"))
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		_, err := tx.Bucket([]byte("users")).Lookup("city", []byte("paris"))
+		assert.Equal(t, ErrIndexNotFound, err)
+		return nil
+	}))
+
+	assert.Equal(t, ErrBucketNameReserved, db.CreateIndex(indexBucket, "city", cityOf))
+	assert.Equal(t, ErrIndexNameRequired, db.CreateIndex([]byte("users"), "", cityOf))
+
+	ch := make(chan error)
+	go func() {
+		ch <- db.View(func(tx *Tx) error {
+			for err := range tx.Check() {
+				return err
+			}
+			return nil
+		})
+	}()
+	assert.Nil(t, <-ch)
+}
+
+func TestBucket_ScanIndex(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.CreateIndex([]byte("users"), "city", cityOf))
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		// index keys that are prefixes of each other or contain zero bytes
+		// keep their order
+		for i, city := range []string{"a", "ab", "a\x00", "b", "a", ""} {
+			if err := b.Put([]byte(fmt.Sprintf("u%d", i)), []byte("x@"+city)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	var entries []string
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		return tx.Bucket([]byte("users")).ScanIndex("city", nil, nil, func(ik, k, v []byte) error {
+			entries = append(entries, fmt.Sprintf("%q=%s", ik, k))
+			assert.Equal(t, append([]byte("x@"), ik...), v)
+			return nil
+		})
+	}))
+	assert.Equal(t, []string{`""=u5`, `"a"=u0`, `"a"=u4`, `"a\x00"=u2`, `"ab"=u1`, `"b"=u3`}, entries)
+
+	entries = entries[:0]
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		return tx.Bucket([]byte("users")).ScanIndex("city", []byte("a\x00"), []byte("b"), func(ik, k, v []byte) error {
+			entries = append(entries, string(k))
+			return nil
+		})
+	}))
+	assert.Equal(t, []string{"u2", "u1"}, entries)
+
+	// deleting the bucket empties its indexes
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		if err := tx.DeleteBucket([]byte("users")); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("u9"), []byte("x@a"))
+	}))
+	assert.Equal(t, []string{"u9"}, func() (keys []string) {
+		assert.Nil(t, db.View(func(tx *Tx) error {
+			return tx.Bucket([]byte("users")).ScanIndex("city", nil, nil, func(_, k, _ []byte) error {
+				keys = append(keys, string(k))
+				return nil
+			})
+		}))
+		return keys
+	}())
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2013 Ben Johnson. All rights reserved.
+// Parts of this file are derived from bbolt, https://github.com/etcd-io/bbolt,
+// use of this source code is governed by a MIT style license that can be
+// found in the LICENSE.bbolt file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"fmt"
+	"sort"
+	"unsafe"
+)
+
+const pageHeaderSize = int(unsafe.Sizeof(page{}))
+
+const minKeysPerPage = 2
+
+const branchPageElementSize = int(unsafe.Sizeof(branchPageElement{}))
+const leafPageElementSize = int(unsafe.Sizeof(leafPageElement{}))
+
+const (
+	branchPageFlag   = 0x01
+	leafPageFlag     = 0x02
+	metaPageFlag     = 0x04
+	freelistPageFlag = 0x10
+)
+
+type pgid uint64
+
+type pgids []pgid
+
+func (s pgids) Len() int           { return len(s) }
+func (s pgids) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s pgids) Less(i, j int) bool { return s[i] < s[j] }
+
+// merge returns the sorted union of a and b.
+func (s pgids) merge(b pgids) pgids {
+	if len(s) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return s
+	}
+	merged := make(pgids, len(s)+len(b))
+	copy(merged, s)
+	copy(merged[len(s):], b)
+	sort.Sort(merged)
+	return merged
+}
+
+// page is the on-disk layout of every page in the data file, the header is
+// followed by count elements, and the page spans overflow extra pages.
+type page struct {
+	id       pgid
+	flags    uint16
+	count    uint16
+	overflow uint32
+}
+
+// typ returns a human readable page type string used for debugging.
+func (p *page) typ() string {
+	if (p.flags & branchPageFlag) != 0 {
+		return "branch"
+	} else if (p.flags & leafPageFlag) != 0 {
+		return "leaf"
+	} else if (p.flags & metaPageFlag) != 0 {
+		return "meta"
+	} else if (p.flags & freelistPageFlag) != 0 {
+		return "freelist"
+	}
+	return fmt.Sprintf("unknown<%02x>", p.flags)
+}
+
+// meta returns a pointer to the metadata section of the page.
+func (p *page) meta() *meta {
+	return (*meta)(unsafe.Add(unsafe.Pointer(p), pageHeaderSize))
+}
+
+// leafPageElement retrieves the leaf node by index
+func (p *page) leafPageElement(index uint16) *leafPageElement {
+	return (*leafPageElement)(unsafe.Add(unsafe.Pointer(p), pageHeaderSize+int(index)*leafPageElementSize))
+}
+
+// leafPageElements retrieves a list of leaf nodes.
+func (p *page) leafPageElements() []leafPageElement {
+	if p.count == 0 {
+		return nil
+	}
+	return unsafe.Slice((*leafPageElement)(unsafe.Add(unsafe.Pointer(p), pageHeaderSize)), int(p.count))
+}
+
+// branchPageElement retrieves the branch node by index
+func (p *page) branchPageElement(index uint16) *branchPageElement {
+	return (*branchPageElement)(unsafe.Add(unsafe.Pointer(p), pageHeaderSize+int(index)*branchPageElementSize))
+}
+
+// branchPageElements retrieves a list of branch nodes.
+func (p *page) branchPageElements() []branchPageElement {
+	if p.count == 0 {
+		return nil
+	}
+	return unsafe.Slice((*branchPageElement)(unsafe.Add(unsafe.Pointer(p), pageHeaderSize)), int(p.count))
+}
+
+// freelistPageIds retrieves the page ids stored in a freelist page.
+// count is 0xFFFF when the real count overflows, it is then stored in the first element.
+func (p *page) freelistPageIds() []pgid {
+	idx, count := 0, int(p.count)
+	if count == 0xFFFF {
+		idx = 1
+		count = int(*(*pgid)(unsafe.Add(unsafe.Pointer(p), pageHeaderSize)))
+	}
+	if count == 0 {
+		return nil
+	}
+	ptr := unsafe.Add(unsafe.Pointer(p), pageHeaderSize+idx*int(unsafe.Sizeof(pgid(0))))
+	return unsafe.Slice((*pgid)(ptr), count)
+}
+
+// branchPageElement represents a node on a branch page.
+type branchPageElement struct {
+	pos   uint32
+	ksize uint32
+	pgid  pgid
+}
+
+// key returns a byte slice of the node key.
+func (n *branchPageElement) key() []byte {
+	return unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(n), n.pos)), int(n.ksize))
+}
+
+// leafPageElement represents a node on a leaf page.
+type leafPageElement struct {
+	flags uint32
+	pos   uint32
+	ksize uint32
+	vsize uint32
+}
+
+// key returns a byte slice of the node key.
+func (n *leafPageElement) key() []byte {
+	return unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(n), n.pos)), int(n.ksize))
+}
+
+// value returns a byte slice of the node value.
+func (n *leafPageElement) value() []byte {
+	return unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(n), n.pos+n.ksize)), int(n.vsize))
+}
+
+// pageInBuffer returns the page at index id of a page aligned buffer.
+func pageInBuffer(buf []byte, pageSize int, id pgid) *page {
+	return (*page)(unsafe.Pointer(&buf[int(id)*pageSize]))
+}
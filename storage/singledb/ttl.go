@@ -0,0 +1,300 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"pkgx/collection/timingwheel"
+)
+
+// defaultTTLInterval is the tick of the timing wheel that sweeps expired keys.
+const defaultTTLInterval = time.Second
+
+// ttlSlots is the number of slots of the timing wheel.
+const ttlSlots = 60
+
+// maxSweepKeys bounds the keys deleted by a single sweep transaction.
+const maxSweepKeys = 1000
+
+// ttlBucket is the internal top-level bucket of the ttls, it holds a bucket
+// per top-level bucket with two buckets inside: the keys ordered by deadline
+// and the deadline of each key.
+var ttlBucket = []byte("\x00ttl")
+
+var (
+	ttlDeadlineBucket = []byte("deadline")
+	ttlKeyBucket      = []byte("key")
+)
+
+// PutWithTTL sets the value for a key that expires after ttl. An expired key
+// is deleted with its index entries by a background sweep, within about one
+// interval of the timing wheel, see WithTTLInterval. Until then it is still
+// returned by Get.
+// A Put of the key without ttl makes it persistent again.
+// Returns ErrBucketNotTopLevel if the bucket is a nested bucket.
+func (b *Bucket) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	if b.tx.db != nil && b.name == nil {
+		return ErrBucketNotTopLevel
+	}
+	if err := b.Put(key, value); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(ttl)
+	if err := b.setTTL(key, deadline); err != nil {
+		return err
+	}
+
+	name, s := string(b.name), b.tx.db.sweeper
+	b.tx.OnCommit(func() {
+		if s != nil {
+			s.schedule(name, deadline)
+		}
+	})
+	return nil
+}
+
+// TTL returns the time left before a key expires, ok is false if the key has no ttl.
+func (b *Bucket) TTL(key []byte) (ttl time.Duration, ok bool) {
+	if b.tx.db == nil || b.name == nil {
+		return 0, false
+	}
+	keys := b.ttlBucket(ttlKeyBucket)
+	if keys == nil {
+		return 0, false
+	}
+	v, ok := keys.get(key)
+	if !ok || len(v) != 8 {
+		return 0, false
+	}
+	return time.Until(decodeDeadline(v)), true
+}
+
+// ttlBucket returns one of the ttl buckets of a top-level bucket, nil if no
+// key of the bucket has a ttl.
+func (b *Bucket) ttlBucket(name []byte) *Bucket {
+	parent := b.tx.root.Bucket(ttlBucket)
+	if parent == nil {
+		return nil
+	}
+	if parent = parent.Bucket(b.name); parent == nil {
+		return nil
+	}
+	return parent.Bucket(name)
+}
+
+// setTTL records the deadline of a key, Put already cleared its previous one.
+func (b *Bucket) setTTL(key []byte, deadline time.Time) error {
+	parent, err := b.tx.root.CreateBucketIfNotExists(ttlBucket)
+	if err != nil {
+		return err
+	}
+	if parent, err = parent.CreateBucketIfNotExists(b.name); err != nil {
+		return err
+	}
+	deadlines, err := parent.CreateBucketIfNotExists(ttlDeadlineBucket)
+	if err != nil {
+		return err
+	}
+	keys, err := parent.CreateBucketIfNotExists(ttlKeyBucket)
+	if err != nil {
+		return err
+	}
+
+	v := encodeDeadline(deadline)
+	if err := deadlines.Put(append(v, key...), []byte{}); err != nil {
+		return err
+	}
+	return keys.Put(key, v)
+}
+
+// clearTTL removes the deadline of a key.
+func (b *Bucket) clearTTL(key []byte) error {
+	keys := b.ttlBucket(ttlKeyBucket)
+	if keys == nil {
+		return nil
+	}
+	v, ok := keys.get(key)
+	if !ok {
+		return nil
+	}
+	entry := append(cloneBytes(v), key...)
+	if _, err := keys.remove(key); err != nil {
+		return err
+	}
+	_, err := b.ttlBucket(ttlDeadlineBucket).remove(entry)
+	return err
+}
+
+// encodeDeadline encodes a deadline so the keys sort by time.
+func encodeDeadline(t time.Time) []byte {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(t.UnixNano()))
+	return v
+}
+
+// decodeDeadline decodes the deadline at the start of v.
+func decodeDeadline(v []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+}
+
+// sweep deletes the expired keys of a top-level bucket and returns the
+// deadline of the next key to expire, zero if no key has a ttl.
+func (db *DB) sweep(name []byte, now time.Time) (next time.Time, err error) {
+	err = db.Update(func(tx *Tx) error {
+		b := tx.root.Bucket(name)
+		if b == nil {
+			return nil
+		}
+		deadlines := b.ttlBucket(ttlDeadlineBucket)
+		if deadlines == nil {
+			return nil
+		}
+
+		var keys [][]byte
+		c := deadlines.Cursor()
+		for k, _ := c.First(); k != nil && len(keys) < maxSweepKeys; k, _ = c.Next() {
+			if decodeDeadline(k).After(now) {
+				break
+			}
+			keys = append(keys, cloneBytes(k[8:]))
+		}
+		for _, key := range keys {
+			if err := b.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		if k, _ := deadlines.Cursor().First(); k != nil {
+			next = decodeDeadline(k)
+		}
+		return nil
+	})
+	return next, err
+}
+
+// sweeper deletes expired keys in the background. A timing wheel fires a
+// timer per top-level bucket at the deadline of its next key to expire.
+type sweeper struct {
+	db       *DB
+	interval time.Duration
+
+	mu     sync.Mutex
+	wheel  *timingwheel.TimingWheel[string, time.Time]
+	next   map[string]time.Time // deadline of the timer of each bucket
+	closed bool
+}
+
+// newSweeper returns a sweeper, the timing wheel starts with the first timer.
+func newSweeper(db *DB, interval time.Duration) *sweeper {
+	if interval <= 0 {
+		interval = defaultTTLInterval
+	}
+	return &sweeper{
+		db:       db,
+		interval: interval,
+		next:     make(map[string]time.Time),
+	}
+}
+
+// schedule sets the timer of a bucket unless it fires before the deadline.
+func (s *sweeper) schedule(name string, deadline time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	if t, ok := s.next[name]; ok && !t.After(deadline) {
+		return
+	}
+	s.next[name] = deadline
+	s.setTimer(name, deadline)
+}
+
+// setTimer must be called with the lock held.
+// The wheel fires a timer in the slot of its delay, which may be up to one
+// interval early, and runs a delay shorter than the interval at once. The
+// delay is at least one interval and expire checks the deadline again.
+func (s *sweeper) setTimer(name string, deadline time.Time) {
+	if s.wheel == nil {
+		s.wheel = timingwheel.NewTimingWheel[string, time.Time](s.interval, ttlSlots, s.expire)
+	}
+	delay := time.Until(deadline)
+	if delay < s.interval {
+		delay = s.interval
+	}
+	_ = s.wheel.SetTimer(name, deadline, delay)
+}
+
+// expire is run by the timing wheel, it sweeps a bucket once its deadline
+// has passed and schedules the next deadline.
+func (s *sweeper) expire(name string, deadline time.Time) {
+	s.mu.Lock()
+	if s.closed || !s.next[name].Equal(deadline) {
+		s.mu.Unlock()
+		return
+	}
+	if time.Now().Before(deadline) {
+		s.setTimer(name, deadline)
+		s.mu.Unlock()
+		return
+	}
+	delete(s.next, name)
+	s.mu.Unlock()
+
+	next, err := s.db.sweep([]byte(name), time.Now())
+	if err == ErrDatabaseNotOpen {
+		return
+	} else if err != nil {
+		// Retried at the next tick.
+		next = time.Now()
+	}
+	if !next.IsZero() {
+		s.schedule(name, next)
+	}
+}
+
+// close stops the timers, a sweep in progress finishes.
+func (s *sweeper) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.wheel != nil {
+		s.wheel.Close()
+	}
+}
+
+// scheduleTTLs sets the timers of the keys with a ttl when the database is opened.
+func (db *DB) scheduleTTLs() error {
+	type timer struct {
+		name     string
+		deadline time.Time
+	}
+
+	var timers []timer
+	err := db.View(func(tx *Tx) error {
+		parent := tx.root.Bucket(ttlBucket)
+		if parent == nil {
+			return nil
+		}
+		return parent.ForEach(func(name, _ []byte) error {
+			deadlines := parent.Bucket(name).Bucket(ttlDeadlineBucket)
+			if deadlines == nil {
+				return nil
+			}
+			if k, _ := deadlines.Cursor().First(); k != nil {
+				timers = append(timers, timer{name: string(name), deadline: decodeDeadline(k)})
+			}
+			return nil
+		})
+	})
+	for _, t := range timers {
+		db.sweeper.schedule(t.name, t.deadline)
+	}
+	return err
+}
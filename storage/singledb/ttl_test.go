@@ -0,0 +1,118 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucket_PutWithTTL(t *testing.T) {
+	path := tempPath(t)
+	db, err := Open(path, WithTTLInterval(10*time.Millisecond))
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.CreateIndex([]byte("sessions"), "city", cityOf))
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		b, err := tx.CreateBucket([]byte("sessions"))
+		if err != nil {
+			return err
+		}
+		_ = b.PutWithTTL([]byte("s1"), []byte("ann@paris"), 50*time.Millisecond)
+		_ = b.PutWithTTL([]byte("s2"), []byte("bob@paris"), 50*time.Millisecond)
+		_ = b.PutWithTTL([]byte("s3"), []byte("cid@paris"), time.Hour)
+		// a plain put makes the key persistent
+		_ = b.Put([]byte("s2"), []byte("bob@rome"))
+
+		nested, err := b.CreateBucket([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, ErrBucketNotTopLevel, nested.PutWithTTL([]byte("k"), nil, time.Second))
+		return nil
+	}))
+
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		b := tx.Bucket([]byte("sessions"))
+		ttl, ok := b.TTL([]byte("s1"))
+		assert.True(t, ok)
+		assert.True(t, ttl > 0 && ttl <= 50*time.Millisecond)
+		_, ok = b.TTL([]byte("s2"))
+		assert.False(t, ok)
+		return nil
+	}))
+
+	// the expired key is deleted with its index entry
+	assert.Eventually(t, func() bool {
+		var found []byte
+		_ = db.View(func(tx *Tx) error {
+			found = tx.Bucket([]byte("sessions")).Get([]byte("s1"))
+			return nil
+		})
+		return found == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		b := tx.Bucket([]byte("sessions"))
+		assert.NotNil(t, b.Get([]byte("s2")))
+		keys, err := b.Lookup("city", []byte("paris"))
+		assert.Equal(t, [][]byte{[]byte("s3")}, keys)
+		return err
+	}))
+
+	// a key that expires while the database is closed is swept after Open
+	assert.Nil(t, db.Update(func(tx *Tx) error {
+		return tx.Bucket([]byte("sessions")).PutWithTTL([]byte("s4"), []byte("dan"), 20*time.Millisecond)
+	}))
+	assert.Nil(t, db.Close())
+	time.Sleep(30 * time.Millisecond)
+
+	db, err = Open(path, WithTTLInterval(10*time.Millisecond))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Eventually(t, func() bool {
+		var found []byte
+		_ = db.View(func(tx *Tx) error {
+			found = tx.Bucket([]byte("sessions")).Get([]byte("s4"))
+			return nil
+		})
+		return found == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		b := tx.Bucket([]byte("sessions"))
+		assert.NotNil(t, b.Get([]byte("s3")))
+		_, ok := b.TTL([]byte("s3"))
+		assert.True(t, ok)
+		return nil
+	}))
+}
+
+func TestDB_CloseStopsSweeper(t *testing.T) {
+	path := tempPath(t)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 3; i++ {
+		db, err := Open(path, WithTTLInterval(10*time.Millisecond))
+		assert.Nil(t, err)
+		assert.Nil(t, db.Update(func(tx *Tx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte("sessions"))
+			if err != nil {
+				return err
+			}
+			return b.PutWithTTL([]byte("s1"), []byte("ann"), time.Hour)
+		}))
+		assert.Nil(t, db.Close())
+	}
+
+	// the timing wheels of the closed databases do not leak goroutines,
+	// polled here as Eventually runs its condition in a goroutine
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
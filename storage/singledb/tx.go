@@ -0,0 +1,373 @@
+// Copyright (c) 2013 Ben Johnson. All rights reserved.
+// Parts of this file are derived from bbolt, https://github.com/etcd-io/bbolt,
+// use of this source code is governed by a MIT style license that can be
+// found in the LICENSE.bbolt file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"fmt"
+	"sort"
+	"unsafe"
+)
+
+// Tx represents a read-only or read/write transaction on the database.
+//
+// Read-only transactions can be used for retrieving values and iterating, a
+// read/write transaction can also change the data. Only one read/write
+// transaction is allowed at a time, while any number of read-only ones run
+// concurrently against the version of the tree they started with.
+//
+// A read/write transaction materializes nodes, spills them to newly allocated
+// pages on commit and only then points a meta page at the new root, so the
+// previous version of the tree stays intact until the meta page is written.
+type Tx struct {
+	db       *DB
+	writable bool
+	managed  bool
+	meta     *meta
+	root     Bucket
+	pages    map[pgid]*page
+	walPages map[pgid]*page // pages of the write-ahead log when the tx began
+	raw      bool           // writes do not maintain indexes and ttls
+	unmapped bool           // a snapshot not holding the mmap, see beginSnapshot
+
+	commitHandlers []func()
+}
+
+// init initializes the transaction.
+func (tx *Tx) init(db *DB) {
+	tx.db = db
+	tx.pages = nil
+
+	// Copy the meta page since it can be changed by the writer.
+	tx.meta = &meta{}
+	db.meta().copy(tx.meta)
+
+	if db.wal != nil {
+		tx.walPages = db.wal.pages
+	}
+
+	tx.root = newBucket(tx)
+	tx.root.bucket = &bucket{root: tx.meta.root}
+
+	// Increment the transaction id and add a page cache for writable transactions.
+	if tx.writable {
+		tx.pages = make(map[pgid]*page)
+		tx.meta.txid += txid(1)
+	}
+}
+
+// ID returns the transaction id.
+func (tx *Tx) ID() int {
+	return int(tx.meta.txid)
+}
+
+// DB returns a reference to the database that created the transaction.
+func (tx *Tx) DB() *DB {
+	return tx.db
+}
+
+// Size returns current database size in bytes as seen by this transaction.
+func (tx *Tx) Size() int64 {
+	return int64(tx.meta.pgid) * int64(tx.db.pageSize)
+}
+
+// Writable returns whether the transaction can perform write operations.
+func (tx *Tx) Writable() bool {
+	return tx.writable
+}
+
+// Cursor creates a cursor associated with the root bucket.
+// All items in the cursor will return a nil value because all root bucket keys
+// point to buckets, unless keys were put into the root bucket directly.
+// The cursor is only valid as long as the transaction is open.
+func (tx *Tx) Cursor() *Cursor {
+	return tx.root.Cursor()
+}
+
+// Bucket retrieves a bucket by name.
+// Returns nil if the bucket does not exist.
+// The bucket instance is only valid for the lifetime of the transaction.
+func (tx *Tx) Bucket(name []byte) *Bucket {
+	if isReserved(name) {
+		return nil
+	}
+	return tx.root.Bucket(name)
+}
+
+// CreateBucket creates a new bucket.
+// Returns an error if the bucket already exists, if the bucket name is blank, or if the bucket name is too long.
+// The bucket instance is only valid for the lifetime of the transaction.
+func (tx *Tx) CreateBucket(name []byte) (*Bucket, error) {
+	if isReserved(name) {
+		return nil, ErrBucketNameReserved
+	}
+	return tx.root.CreateBucket(name)
+}
+
+// CreateBucketIfNotExists creates a new bucket if it doesn't already exist.
+// Returns an error if the bucket name is blank, or if the bucket name is too long.
+// The bucket instance is only valid for the lifetime of the transaction.
+func (tx *Tx) CreateBucketIfNotExists(name []byte) (*Bucket, error) {
+	if isReserved(name) {
+		return nil, ErrBucketNameReserved
+	}
+	return tx.root.CreateBucketIfNotExists(name)
+}
+
+// DeleteBucket deletes a bucket.
+// Returns an error if the bucket cannot be found or if the key represents a non-bucket value.
+func (tx *Tx) DeleteBucket(name []byte) error {
+	if isReserved(name) {
+		return ErrBucketNameReserved
+	}
+	return tx.root.DeleteBucket(name)
+}
+
+// ForEach executes a function for each bucket in the root, the internal
+// buckets of the indexes and ttls are skipped.
+// If the provided function returns an error then the iteration is stopped and
+// the error is returned to the caller.
+func (tx *Tx) ForEach(fn func(name []byte, b *Bucket) error) error {
+	return tx.root.ForEach(func(k, v []byte) error {
+		if v != nil || isReserved(k) {
+			return nil
+		}
+		return fn(k, tx.root.Bucket(k))
+	})
+}
+
+// Get retrieves the value for a key in the root bucket, nil is returned if
+// the key does not exist. The returned value is only valid for the life of
+// the transaction.
+func (tx *Tx) Get(key []byte) []byte {
+	if tx.db == nil {
+		return nil
+	}
+	return tx.root.Get(key)
+}
+
+// Put sets the value for a key in the root bucket, the existing value is overwritten.
+func (tx *Tx) Put(key []byte, value []byte) error {
+	return tx.root.Put(key, value)
+}
+
+// Delete removes a key from the root bucket, deleting a key that does not
+// exist is a no-op.
+func (tx *Tx) Delete(key []byte) error {
+	return tx.root.Delete(key)
+}
+
+// Range returns up to size records of the root bucket in key order, starting
+// at the first key greater than or equal to key.
+func (tx *Tx) Range(key []byte, size int) []Record {
+	if tx.db == nil {
+		return nil
+	}
+	return tx.root.Range(key, size)
+}
+
+// Commit writes all changes to disk and updates the meta page.
+// Returns an error if a disk write error occurs, or if Commit is
+// called on a read-only transaction.
+func (tx *Tx) Commit() error {
+	if tx.managed {
+		panic("managed tx commit not allowed")
+	}
+	if tx.db == nil {
+		return ErrTxClosed
+	} else if !tx.writable {
+		return ErrTxNotWritable
+	}
+
+	db := tx.db
+
+	// Rebalance nodes which have had deletions.
+	tx.root.rebalance()
+
+	// spill data onto dirty pages.
+	if err := tx.root.spill(); err != nil {
+		tx.rollback()
+		return err
+	}
+	tx.meta.root = tx.root.root
+
+	opgid := tx.meta.pgid
+
+	// Free the freelist and allocate new pages for it. This will overestimate
+	// the size of the freelist but not underestimate the size (which would be bad).
+	db.freelist.free(tx.meta.txid, tx.page(tx.meta.freelist))
+	p, err := tx.allocate((db.freelist.size() / db.pageSize) + 1)
+	if err != nil {
+		tx.rollback()
+		return err
+	}
+	if err := db.freelist.write(p); err != nil {
+		tx.rollback()
+		return err
+	}
+	tx.meta.freelist = p.id
+
+	// In WAL mode the pages and the meta are appended to the log, the data
+	// file grows when they are checkpointed.
+	if db.wal != nil {
+		if err := tx.writeWAL(); err != nil {
+			tx.rollback()
+			return err
+		}
+		tx.commit()
+		return nil
+	}
+
+	// If the high water mark has moved up then attempt to grow the database.
+	if tx.meta.pgid > opgid {
+		if err := db.grow(int(tx.meta.pgid+1) * db.pageSize); err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+
+	// Write dirty pages to disk.
+	if err := tx.write(); err != nil {
+		tx.rollback()
+		return err
+	}
+
+	// Write meta to disk.
+	if err := tx.writeMeta(); err != nil {
+		tx.rollback()
+		return err
+	}
+
+	tx.commit()
+	return nil
+}
+
+// commit closes a committed transaction and runs its commit handlers.
+func (tx *Tx) commit() {
+	handlers := tx.commitHandlers
+	tx.close()
+	for _, fn := range handlers {
+		fn()
+	}
+}
+
+// OnCommit adds a handler function to be executed after the transaction
+// successfully commits, the handlers run after the writer lock is released.
+func (tx *Tx) OnCommit(fn func()) {
+	tx.commitHandlers = append(tx.commitHandlers, fn)
+}
+
+// Rollback closes the transaction and ignores all previous updates.
+// Read-only transactions must be rolled back and not committed.
+func (tx *Tx) Rollback() error {
+	if tx.managed {
+		panic("managed tx rollback not allowed")
+	}
+	if tx.db == nil {
+		return ErrTxClosed
+	}
+	tx.rollback()
+	return nil
+}
+
+func (tx *Tx) rollback() {
+	if tx.db == nil {
+		return
+	}
+	if tx.writable {
+		tx.db.freelist.rollback(tx.meta.txid)
+		tx.db.freelist.reload(tx.db.latestPage(tx.db.meta().freelist))
+	}
+	tx.close()
+}
+
+func (tx *Tx) close() {
+	if tx.db == nil {
+		return
+	}
+	if tx.writable {
+		// Remove transaction ref & writer lock.
+		tx.db.rwtx = nil
+		tx.db.rwlock.Unlock()
+	} else {
+		tx.db.removeTx(tx)
+	}
+
+	// Clear all references.
+	tx.db = nil
+	tx.meta = nil
+	tx.root = Bucket{tx: tx}
+	tx.pages = nil
+	tx.walPages = nil
+	tx.commitHandlers = nil
+}
+
+// page returns a reference to the page with a given id.
+// If page has been written to then a temporary buffered page is returned.
+func (tx *Tx) page(id pgid) *page {
+	if tx.pages != nil {
+		if p, ok := tx.pages[id]; ok {
+			return p
+		}
+	}
+	if p, ok := tx.walPages[id]; ok {
+		return p
+	}
+	return tx.db.page(id)
+}
+
+// allocate returns a contiguous block of memory starting at a given page.
+func (tx *Tx) allocate(count int) (*page, error) {
+	p, err := tx.db.allocate(tx.meta.txid, count)
+	if err != nil {
+		return nil, err
+	}
+	tx.pages[p.id] = p
+	return p, nil
+}
+
+// write writes any dirty pages to disk.
+func (tx *Tx) write() error {
+	// Sort pages by id.
+	pages := make(pages, 0, len(tx.pages))
+	for _, p := range tx.pages {
+		pages = append(pages, p)
+	}
+	sort.Sort(pages)
+
+	// Write pages to disk in order.
+	for _, p := range pages {
+		size := (int(p.overflow) + 1) * tx.db.pageSize
+		offset := int64(p.id) * int64(tx.db.pageSize)
+		buf := unsafe.Slice((*byte)(unsafe.Pointer(p)), size)
+		if _, err := tx.db.ops.writeAt(tx.db.file, buf, offset); err != nil {
+			return err
+		}
+	}
+
+	return tx.db.ops.sync(tx.db.file)
+}
+
+// writeMeta writes the meta to the disk.
+// The meta page alternates with the transaction id, so a torn write never
+// damages the meta page of the last committed transaction.
+func (tx *Tx) writeMeta() error {
+	buf := make([]byte, tx.db.pageSize)
+	p := pageInBuffer(buf, tx.db.pageSize, 0)
+	tx.meta.write(p)
+
+	if _, err := tx.db.ops.writeAt(tx.db.file, buf, int64(p.id)*int64(tx.db.pageSize)); err != nil {
+		return fmt.Errorf("meta write error: %w", err)
+	}
+	return tx.db.ops.sync(tx.db.file)
+}
+
+type pages []*page
+
+func (s pages) Len() int           { return len(s) }
+func (s pages) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s pages) Less(i, j int) bool { return s[i].id < s[j].id }
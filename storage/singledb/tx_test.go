@@ -0,0 +1,256 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Update(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	err = db.Update(func(tx *Tx) error {
+		assert.True(t, tx.Writable())
+		assert.Nil(t, tx.Put([]byte("a"), []byte("1")))
+		assert.Nil(t, tx.Put([]byte("b"), []byte("2")))
+		assert.Equal(t, []byte("1"), tx.Get([]byte("a")))
+		return tx.Delete([]byte("b"))
+	})
+	assert.Nil(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		assert.False(t, tx.Writable())
+		assert.Equal(t, []byte("1"), tx.Get([]byte("a")))
+		assert.Nil(t, tx.Get([]byte("b")))
+		assert.Equal(t, ErrTxNotWritable, tx.Put([]byte("c"), nil))
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestDB_Update_Rollback(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+
+	errRollback := errors.New("rollback")
+	err = db.Update(func(tx *Tx) error {
+		assert.Nil(t, tx.Put([]byte("a"), []byte("2")))
+		return errRollback
+	})
+	assert.Equal(t, errRollback, err)
+
+	err = db.Update(func(tx *Tx) error {
+		assert.Nil(t, tx.Put([]byte("a"), []byte("3")))
+		panic("boom")
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "boom")
+
+	// managed transactions can not be committed by the callback
+	err = db.Update(func(tx *Tx) error {
+		assert.Nil(t, tx.Put([]byte("a"), []byte("4")))
+		return tx.Commit()
+	})
+	assert.NotNil(t, err)
+
+	value, _ := db.Get([]byte("a"))
+	assert.Equal(t, []byte("1"), value)
+}
+
+func TestDB_Begin(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	assert.Nil(t, err)
+	id := tx.ID()
+	assert.Nil(t, tx.Put([]byte("a"), []byte("1")))
+	assert.Nil(t, tx.Commit())
+	assert.Equal(t, ErrTxClosed, tx.Commit())
+
+	tx, err = db.Begin(true)
+	assert.Nil(t, err)
+	assert.Equal(t, id+1, tx.ID())
+	assert.Nil(t, tx.Put([]byte("a"), []byte("2")))
+	assert.Nil(t, tx.Rollback())
+
+	tx, err = db.Begin(false)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), tx.Get([]byte("a")))
+	assert.Equal(t, ErrTxNotWritable, tx.Commit())
+	assert.Nil(t, tx.Rollback())
+}
+
+func TestDB_ConcurrentReaders(t *testing.T) {
+	// a large initial mmap keeps the writer from remapping under the open reader
+	db, err := Open(tempPath(t), WithInitialMmapSize(1<<20))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put([]byte("key"), []byte("0")))
+
+	// a reader keeps seeing its snapshot while the writer commits
+	tx, err := db.Begin(false)
+	assert.Nil(t, err)
+	for i := 1; i <= 10; i++ {
+		assert.Nil(t, db.Put([]byte("key"), []byte(fmt.Sprint(i))))
+	}
+	assert.Equal(t, []byte("0"), tx.Get([]byte("key")))
+	assert.Nil(t, tx.Rollback())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if i%2 == 0 {
+					assert.Nil(t, db.Put([]byte(fmt.Sprintf("%d-%d", i, j)), []byte("v")))
+					continue
+				}
+				assert.Nil(t, db.View(func(tx *Tx) error {
+					assert.NotNil(t, tx.Get([]byte("key")))
+					return nil
+				}))
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, db.Range([]byte("0-"), 1000), 4*50+1)
+}
+
+func TestDB_MetaFallback(t *testing.T) {
+	path := tempPath(t)
+	db, err := Open(path)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("a"), []byte("1")))
+	assert.Nil(t, db.Put([]byte("a"), []byte("2")))
+	id := db.meta().txid
+	pageSize := db.pageSize
+	assert.Nil(t, db.Close())
+
+	// tear the meta page of the last commit
+	f, err := os.OpenFile(path, os.O_RDWR, 0666)
+	assert.Nil(t, err)
+	_, err = f.WriteAt([]byte{0xFF, 0xFF, 0xFF, 0xFF}, int64(id%2)*int64(pageSize)+int64(pageHeaderSize)+48)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	db, err = Open(path)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, id-1, db.meta().txid)
+	value, _ := db.Get([]byte("a"))
+	assert.Equal(t, []byte("1"), value)
+}
+
+func TestTx_Check(t *testing.T) {
+	db, err := Open(tempPath(t))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Update(func(tx *Tx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte("widgets"))
+			if err != nil {
+				return err
+			}
+			for j := 0; j < 100; j++ {
+				if err := b.Put([]byte(fmt.Sprintf("%02d-%03d", i, j)), make([]byte, 50)); err != nil {
+					return err
+				}
+			}
+			return b.Delete([]byte(fmt.Sprintf("%02d-%03d", i-1, 0)))
+		}))
+	}
+
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		for err := range tx.Check() {
+			t.Error(err)
+		}
+
+		s := tx.Bucket([]byte("widgets")).Stats()
+		assert.Equal(t, 991, s.KeyN)
+		assert.Equal(t, 1, s.BucketN)
+		assert.True(t, s.Depth >= 2)
+		return nil
+	}))
+
+	stats := db.Stats()
+	assert.Equal(t, 11, stats.TxID) // a new file starts at txid 1
+	assert.True(t, stats.FreePageN+stats.PendingPageN > 0)
+
+	// a page that is both reachable and free is reported, the write
+	// transaction checks the freelist of the writer
+	assert.NotNil(t, db.Update(func(tx *Tx) error {
+		db.freelist.ids = append(db.freelist.ids, db.meta().root)
+		var errs []error
+		for err := range tx.Check() {
+			errs = append(errs, err)
+		}
+		assert.NotEmpty(t, errs)
+		return fmt.Errorf("rollback")
+	}))
+
+	// a read transaction checks the freelist of its version while the
+	// writer changes its own
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			_ = db.Update(func(tx *Tx) error {
+				return tx.Bucket([]byte("widgets")).Delete([]byte(fmt.Sprintf("%02d-%03d", i/10, i%10+1)))
+			})
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, db.View(func(tx *Tx) error {
+			for err := range tx.Check() {
+				t.Error(err)
+			}
+			return nil
+		}))
+	}
+	<-done
+}
+
+func TestDB_FreePages_LongReader(t *testing.T) {
+	db, err := Open(tempPath(t), WithInitialMmapSize(1<<22))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	put := func(i int) {
+		assert.Nil(t, db.Update(func(tx *Tx) error {
+			return tx.Put([]byte(fmt.Sprintf("%04d", i%10)), make([]byte, 500))
+		}))
+	}
+	put(0)
+
+	// a reader that stays open for the whole test
+	reader, err := db.Begin(false)
+	assert.Nil(t, err)
+	defer reader.Rollback()
+
+	for i := 1; i < 200; i++ {
+		put(i)
+	}
+
+	// only the pages the reader can still see stay pending, the file does not
+	// grow with every commit
+	stats := db.Stats()
+	assert.Less(t, stats.PendingPageN, 10)
+	assert.Less(t, stats.PageN, 40)
+	assert.NotNil(t, reader.Get([]byte("0000")))
+}
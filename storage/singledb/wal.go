@@ -0,0 +1,401 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"time"
+	"unsafe"
+)
+
+// walMagic marks a record of the write-ahead log.
+const walMagic uint32 = 0x5D1B0A1
+
+// walHeaderSize is the size of a record header:
+// magic uint32, flags uint32, txid uint64, size uint64, checksum uint64.
+const walHeaderSize = 32
+
+// defaultCheckpointInterval is how often the write-ahead log is checkpointed.
+const defaultCheckpointInterval = time.Second
+
+// defaultCheckpointSize is the log size that triggers a checkpoint before
+// the interval passes.
+const defaultCheckpointSize = 16 * 1024 * 1024 // 16MB
+
+// wal is the write-ahead log of a database.
+//
+// In WAL mode a commit appends the dirty pages and the meta page of the
+// transaction as one record to the log and syncs only the log. The pages are
+// kept in memory until a checkpoint writes them into the data file and
+// truncates the log. On Open, the valid records of a log left behind by a
+// crash are replayed.
+//
+// The page map is copy-on-write: a transaction takes the map of the last
+// commit when it begins, a commit or checkpoint installs a new map.
+type wal struct {
+	file  *os.File
+	size  int64          // offset of the next record
+	pages map[pgid]*page // pages committed to the log but not checkpointed
+	meta  *meta          // meta of the last record, nil after a checkpoint
+
+	interval time.Duration // time between two checkpoints
+	limit    int64         // log size that triggers a checkpoint
+	notify   chan struct{}
+	closing  chan struct{}
+	closed   chan struct{}
+}
+
+// walPath returns the path of the write-ahead log of a data file.
+func walPath(path string) string {
+	return path + "-wal"
+}
+
+// openWAL opens the write-ahead log and replays the records left behind by a
+// crash. The replayed pages are checkpointed into the data file unless the
+// database is read-only, they are kept in memory then.
+// It is called by Open before the data file is mapped.
+func (db *DB) openWAL() error {
+	// Without a log there is nothing to replay, the log is only created by
+	// a writable database in WAL mode.
+	if _, err := os.Stat(walPath(db.path)); os.IsNotExist(err) {
+		if !db.walMode || db.readOnly {
+			return nil
+		}
+	} else if err != nil {
+		return err
+	}
+
+	flag := os.O_RDWR | os.O_CREATE
+	if db.readOnly {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(walPath(db.path), flag, 0666)
+	if err != nil {
+		return err
+	}
+
+	w := &wal{
+		file:     f,
+		pages:    make(map[pgid]*page),
+		interval: db.checkpointInterval,
+		limit:    db.checkpointSize,
+	}
+	if w.interval <= 0 {
+		w.interval = defaultCheckpointInterval
+	}
+	db.wal = w
+	if err := w.replay(db.pageSize, db.fileTxID()); err != nil {
+		return err
+	}
+
+	if db.readOnly {
+		return nil
+	}
+	if err := db.checkpoint(); err != nil {
+		return err
+	}
+
+	// A log left behind by WAL mode is removed once it is checkpointed.
+	if !db.walMode {
+		db.wal = nil
+		_ = f.Close()
+		return os.Remove(walPath(db.path))
+	}
+
+	w.notify = make(chan struct{}, 1)
+	w.closing = make(chan struct{})
+	w.closed = make(chan struct{})
+	go db.checkpointLoop(w)
+	return nil
+}
+
+// fileTxID returns the transaction id of the last version in the data file,
+// it reads the meta pages before the file is mapped.
+func (db *DB) fileTxID() txid {
+	var id txid
+	buf := make([]byte, db.pageSize)
+	for i := 0; i < 2; i++ {
+		if _, err := db.file.ReadAt(buf, int64(i*db.pageSize)); err != nil {
+			continue
+		}
+		if m := pageInBuffer(buf, db.pageSize, 0).meta(); m.validate() == nil && m.txid > id {
+			id = m.txid
+		}
+	}
+	return id
+}
+
+// replay reads the records of the log, it stops at the first torn or invalid
+// record. Records must have consecutive transaction ids following the last
+// version of the data file, the records of a log whose truncation was lost
+// are already in the data file and ignored.
+func (w *wal) replay(pageSize int, base txid) error {
+	var header [walHeaderSize]byte
+	for {
+		if _, err := w.file.ReadAt(header[:], w.size); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		magic := binary.LittleEndian.Uint32(header[0:])
+		id := txid(binary.LittleEndian.Uint64(header[8:]))
+		size := binary.LittleEndian.Uint64(header[16:])
+		checksum := binary.LittleEndian.Uint64(header[24:])
+		if magic != walMagic || size == 0 || size%uint64(pageSize) != 0 {
+			return nil
+		}
+		if id != base+1 {
+			return nil
+		}
+
+		buf := make([]byte, size)
+		if _, err := w.file.ReadAt(buf, w.size+walHeaderSize); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if walChecksum(buf) != checksum {
+			return nil
+		}
+
+		pages, m, ok := walDecode(buf, pageSize)
+		if !ok || m.txid != id {
+			return nil
+		}
+
+		// The pages freed by earlier records are left out like a commit
+		// does, a stale page could overlap the overflow of a newer one.
+		for _, p := range pages {
+			if p.id == m.freelist {
+				for _, id := range p.freelistPageIds() {
+					delete(w.pages, id)
+				}
+			}
+		}
+		for _, p := range pages {
+			w.pages[p.id] = p
+		}
+		w.meta = m
+		w.size += walHeaderSize + int64(size)
+		base = id
+	}
+}
+
+// walDecode splits the payload of a record into its pages and the meta page
+// at the end.
+func walDecode(buf []byte, pageSize int) (pages []*page, m *meta, ok bool) {
+	for off := 0; off < len(buf); {
+		p := (*page)(unsafe.Pointer(&buf[off]))
+		size := (int(p.overflow) + 1) * pageSize
+		if off+size > len(buf) {
+			return nil, nil, false
+		}
+		off += size
+
+		if (p.flags & metaPageFlag) != 0 {
+			if off != len(buf) || p.meta().validate() != nil {
+				return nil, nil, false
+			}
+			m = &meta{}
+			p.meta().copy(m)
+			return pages, m, true
+		}
+		pages = append(pages, p)
+	}
+	return nil, nil, false
+}
+
+// walChecksum returns the checksum of the payload of a record.
+func walChecksum(buf []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(buf)
+	return h.Sum64()
+}
+
+// writeWAL appends the dirty pages and the meta of the transaction to the
+// log as a single record and syncs the log.
+func (tx *Tx) writeWAL() error {
+	db := tx.db
+	w := db.wal
+
+	pages := make(pages, 0, len(tx.pages))
+	size := tx.db.pageSize
+	for _, p := range tx.pages {
+		pages = append(pages, p)
+		size += (int(p.overflow) + 1) * tx.db.pageSize
+	}
+	sort.Sort(pages)
+
+	// Build the record: header, the pages in order and the meta page.
+	buf := make([]byte, walHeaderSize+size)
+	off := walHeaderSize
+	for _, p := range pages {
+		sz := (int(p.overflow) + 1) * tx.db.pageSize
+		off += copy(buf[off:], unsafe.Slice((*byte)(unsafe.Pointer(p)), sz))
+	}
+	tx.meta.write(pageInBuffer(buf[off:], tx.db.pageSize, 0))
+
+	binary.LittleEndian.PutUint32(buf[0:], walMagic)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(tx.meta.txid))
+	binary.LittleEndian.PutUint64(buf[16:], uint64(size))
+	binary.LittleEndian.PutUint64(buf[24:], walChecksum(buf[walHeaderSize:]))
+
+	// The next record is written at the same offset if this one fails, a
+	// torn record is never followed by a valid one.
+	if _, err := db.ops.writeAt(w.file, buf, w.size); err != nil {
+		return fmt.Errorf("wal write error: %w", err)
+	}
+	if err := db.ops.sync(w.file); err != nil {
+		return fmt.Errorf("wal sync error: %w", err)
+	}
+	w.size += int64(len(buf))
+
+	// Install the new page map, the pages freed by this transaction are left
+	// out so a checkpoint never writes stale pages.
+	m := make(map[pgid]*page, len(w.pages)+len(tx.pages))
+	for id, p := range w.pages {
+		m[id] = p
+	}
+	if txp := db.freelist.pending[tx.meta.txid]; txp != nil {
+		for _, id := range txp.ids {
+			delete(m, id)
+		}
+	}
+	for id, p := range tx.pages {
+		m[id] = p
+	}
+	meta := &meta{}
+	tx.meta.copy(meta)
+
+	db.metalock.Lock()
+	w.pages = m
+	w.meta = meta
+	db.metalock.Unlock()
+
+	if w.limit > 0 && w.size >= w.limit && w.notify != nil {
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Checkpoint writes the pages of the write-ahead log into the data file and
+// truncates the log. It is a no-op if the database is not in WAL mode.
+// Checkpoints also run in the background, it waits for the current write
+// transaction to finish.
+func (db *DB) Checkpoint() error {
+	db.rwlock.Lock()
+	defer db.rwlock.Unlock()
+
+	if !db.opened {
+		return ErrDatabaseNotOpen
+	}
+	return db.checkpoint()
+}
+
+// checkpoint must be called by the writer, while no write transaction is open.
+//
+// The pages written to the data file are never seen through the mmap by an
+// open read transaction: a page is only rewritten once it was freed and
+// released, which waits for the readers that could see it. Readers that
+// started before the checkpoint keep reading the log pages they started with.
+func (db *DB) checkpoint() error {
+	w := db.wal
+	if w == nil || w.meta == nil {
+		return nil
+	} else if db.readOnly {
+		return ErrDatabaseReadOnly
+	}
+
+	m := &meta{}
+	w.meta.copy(m)
+	if err := db.grow(int(m.pgid+1) * db.pageSize); err != nil {
+		return err
+	}
+
+	// Write pages to the data file in order.
+	ids := make(pgids, 0, len(w.pages))
+	for id := range w.pages {
+		ids = append(ids, id)
+	}
+	sort.Sort(ids)
+	for _, id := range ids {
+		p := w.pages[id]
+		buf := unsafe.Slice((*byte)(unsafe.Pointer(p)), (int(p.overflow)+1)*db.pageSize)
+		if _, err := db.ops.writeAt(db.file, buf, int64(id)*int64(db.pageSize)); err != nil {
+			return err
+		}
+	}
+	if err := db.ops.sync(db.file); err != nil {
+		return err
+	}
+
+	// Write the meta page last, the log is still valid if it fails.
+	buf := make([]byte, db.pageSize)
+	p := pageInBuffer(buf, db.pageSize, 0)
+	m.write(p)
+	if _, err := db.ops.writeAt(db.file, buf, int64(p.id)*int64(db.pageSize)); err != nil {
+		return fmt.Errorf("meta write error: %w", err)
+	}
+	if err := db.ops.sync(db.file); err != nil {
+		return err
+	}
+
+	// The checkpoint is complete once the meta is synced, the next record is
+	// written at the start of the log even if the truncation fails.
+	db.metalock.Lock()
+	w.pages = make(map[pgid]*page)
+	w.meta = nil
+	db.metalock.Unlock()
+	w.size = 0
+
+	// Truncate the log.
+	if err := db.ops.truncate(w.file, 0); err != nil {
+		return err
+	}
+	return db.ops.sync(w.file)
+}
+
+// checkpointLoop checkpoints the log every interval or once it grows over
+// its size limit. A failed checkpoint is retried the next time.
+func (db *DB) checkpointLoop(w *wal) {
+	defer close(w.closed)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.closing:
+			return
+		case <-ticker.C:
+		case <-w.notify:
+		}
+
+		db.rwlock.Lock()
+		if db.opened {
+			_ = db.checkpoint()
+		}
+		db.rwlock.Unlock()
+	}
+}
+
+// stop stops the background checkpoints and waits for them to return.
+func (w *wal) stop() {
+	if w.closing == nil {
+		return
+	}
+	select {
+	case <-w.closing:
+	default:
+		close(w.closing)
+	}
+	<-w.closed
+}
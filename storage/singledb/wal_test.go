@@ -0,0 +1,187 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package singledb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// copyFile copies the data file or the log of a running database, like the
+// files a crash leaves behind.
+func copyFile(t *testing.T, src, dst string) {
+	in, err := os.Open(src)
+	assert.Nil(t, err)
+	defer in.Close()
+	out, err := os.Create(dst)
+	assert.Nil(t, err)
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	assert.Nil(t, err)
+}
+
+func countKeys(t *testing.T, db *DB) (n int) {
+	assert.Nil(t, db.View(func(tx *Tx) error {
+		for err := range tx.Check() {
+			t.Error(err)
+		}
+		if b := tx.Bucket([]byte("widgets")); b != nil {
+			n = b.Stats().KeyN
+		}
+		return nil
+	}))
+	return n
+}
+
+func TestDB_WAL(t *testing.T) {
+	path := tempPath(t)
+	db, err := Open(path, WithWAL(true), WithCheckpointInterval(time.Hour))
+	assert.Nil(t, err)
+
+	putN(t, db, 0, 200, true)
+	assert.Equal(t, 200, countKeys(t, db))
+
+	// the commits are in the log, not in the data file
+	info, err := os.Stat(walPath(path))
+	assert.Nil(t, err)
+	assert.NotZero(t, info.Size())
+
+	assert.Nil(t, db.Checkpoint())
+	info, err = os.Stat(walPath(path))
+	assert.Nil(t, err)
+	assert.Zero(t, info.Size())
+	assert.Equal(t, 200, countKeys(t, db))
+
+	putN(t, db, 200, 300, true)
+	assert.Nil(t, db.Close())
+
+	// Close checkpoints the log, the data file is complete without WAL mode
+	db, err = Open(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 300, countKeys(t, db))
+	assert.Nil(t, db.Close())
+
+	// no log is created without WAL mode or by a read-only open
+	_, err = os.Stat(walPath(path))
+	assert.True(t, os.IsNotExist(err))
+	db, err = Open(path, WithReadOnly(true), WithWAL(true))
+	assert.Nil(t, err)
+	assert.Equal(t, 300, countKeys(t, db))
+	assert.Nil(t, db.Close())
+	_, err = os.Stat(walPath(path))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDB_WAL_Replay(t *testing.T) {
+	path := tempPath(t)
+	db, err := Open(path, WithWAL(true), WithCheckpointInterval(time.Hour))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	putN(t, db, 0, 100, true)
+	assert.Nil(t, db.Checkpoint())
+	putN(t, db, 100, 150, true)
+
+	// simulate a crash by copying the files of the running database
+	crashed := filepath.Join(t.TempDir(), "crashed.db")
+	copyFile(t, path, crashed)
+	copyFile(t, walPath(path), walPath(crashed))
+
+	// a read-only open replays the log in memory
+	ro, err := Open(crashed, WithReadOnly(true))
+	assert.Nil(t, err)
+	assert.Equal(t, 150, countKeys(t, ro))
+	assert.Nil(t, ro.Close())
+
+	// tear the last record
+	info, err := os.Stat(walPath(crashed))
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(walPath(crashed), info.Size()-10))
+
+	replayed, err := Open(crashed)
+	assert.Nil(t, err)
+	assert.Equal(t, 149, countKeys(t, replayed))
+	assert.Nil(t, replayed.Close())
+
+	// the log is checkpointed and removed once replayed without WAL mode
+	_, err = os.Stat(walPath(crashed))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDB_WAL_Readers(t *testing.T) {
+	db, err := Open(tempPath(t), WithWAL(true), WithCheckpointSize(64*1024), WithInitialMmapSize(1<<22))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	putN(t, db, 0, 100, true)
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				assert.Nil(t, db.View(func(tx *Tx) error {
+					n := tx.Bucket([]byte("widgets")).Stats().KeyN
+					if n < 100 {
+						return fmt.Errorf("saw %d keys", n)
+					}
+					return nil
+				}))
+			}
+		}()
+	}
+	putN(t, db, 100, 400, true)
+	wg.Wait()
+
+	assert.Equal(t, 400, countKeys(t, db))
+}
+
+func TestDB_Batch(t *testing.T) {
+	db, err := Open(tempPath(t), WithWAL(true), WithMaxBatchDelay(50*time.Millisecond))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	before := db.Stats().TxID
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- db.Batch(func(tx *Tx) error {
+				if i == 7 {
+					return fmt.Errorf("fail %d", i)
+				}
+				b, err := tx.CreateBucketIfNotExists([]byte("widgets"))
+				if err != nil {
+					return err
+				}
+				return b.Put([]byte(fmt.Sprintf("%04d", i)), []byte("v"))
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	var failed int
+	for err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, n-1, countKeys(t, db))
+
+	// the calls were combined into far fewer commits
+	assert.Less(t, db.Stats().TxID-before, n/2)
+}